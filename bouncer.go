@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/lrstanley/girc"
+)
+
+const (
+	capBouncerNetworks = "soju.im/bouncer-networks"
+	capBouncerNotify   = "soju.im/bouncer-networks-notify"
+	cmdBouncer         = "BOUNCER"
+)
+
+// bouncerNetworkMsg is a BOUNCER NETWORK line, attrs is nil once
+// the network is removed.
+type bouncerNetworkMsg struct {
+	id    serverID
+	netID string
+	attrs girc.Tags
+}
+
+// zncLogin returns the user/network part of a ZNC style
+// "user/network:pass" password, ZNC reads it from PASS as is.
+func zncLogin(pass string) (string, bool) {
+	user, _, ok := strings.Cut(pass, ":")
+	if !ok || !strings.Contains(user, "/") || strings.ContainsAny(user, " ") {
+		return "", false
+	}
+
+	return user, true
+}
+
+// login returns the username and password sent on registration.
+func (s *serverEntry) login() (user, pass string) {
+	user = s.user
+	if user == "" {
+		user = s.nick
+	}
+
+	return user, s.pass
+}
+
+// bindBouncerNetwork binds a connection to its soju network. It runs on
+// RPL_LOGGEDIN, which soju sends before RPL_SASLSUCCESS, so BIND goes
+// out ahead of the CAP END girc answers that with.
+func bindBouncerNetwork(c *girc.Client, s *serverEntry, flood floodConfig) {
+	if s.bouncerID == "" {
+		return
+	}
+
+	s.queue.sendFirst(flood, c, &girc.Event{Command: cmdBouncer, Params: []string{"BIND", s.bouncerID}})
+}
+
+// listBouncerNetworks asks a soju style bouncer for its networks,
+// connections bound to one network don't.
+func listBouncerNetworks(c *girc.Client, s *serverEntry) {
+	if s.bouncerNet != "" || !c.HasCapability(capBouncerNetworks) {
+		return
+	}
+
+	sendFromHandler(c, s.id, &girc.Event{Command: cmdBouncer, Params: []string{"LISTNETWORKS"}})
+}
+
+// handleBouncer forwards BOUNCER NETWORK <id> <attrs|*>.
+func handleBouncer(id serverID, e girc.Event) {
+	if len(e.Params) < 3 || e.Params[0] != "NETWORK" {
+		return
+	}
+
+	msg := bouncerNetworkMsg{id: id, netID: e.Params[1]}
+	if e.Params[2] != "*" {
+		msg.attrs = girc.ParseTags(e.Params[2])
+	}
+
+	program.Send(msg)
+}
+
+// applyBouncerNetwork adds a server entry bound to each network of the
+// bouncer, it logs in as user/network on the same address.
+// ZNC has no network listing, there each network is added by hand.
+func (m *model) applyBouncerNetwork(msg bouncerNetworkMsg) tea.Cmd {
+	parent, ok := m.servers[msg.id]
+	if !ok {
+		return nil
+	}
+
+	cid, known := parent.bouncerNets[msg.netID]
+	if msg.attrs == nil {
+		if child, ok := m.servers[cid]; known && ok {
+			m.pushSysLine(parent.id, "_sys", "-- bouncer network "+child.name+" was removed --")
+			m.dropServer(cid)
+		}
+		delete(parent.bouncerNets, msg.netID)
+		return nil
+	}
+
+	name, _ := msg.attrs.Get("name")
+	if name == "" {
+		name, _ = msg.attrs.Get("host")
+	}
+
+	if name == "" {
+		name = msg.netID
+	}
+
+	netState, _ := msg.attrs.Get("state")
+	if known {
+		if child, ok := m.servers[cid]; ok && netState != "" {
+			m.pushSysLine(child.id, "_sys", "-- bouncer: "+name+" is "+netState+" --")
+		}
+		return nil
+	}
+
+	user, pass := parent.login()
+
+	cfg := parent.config()
+	cfg.Name = parent.name + "/" + name
+	cfg.Chans = nil
+	cfg.ChanKeys = nil
+
+	id := m.nextID
+	m.nextID++
+	child := newServerEntry(id, cfg)
+	child.user = user
+	child.pass = pass
+	child.bouncerNet = name
+	child.bouncerID = msg.netID
+	child.tlsPin = m.cfg.TLSPins[cfg.Address]
+	m.servers[id] = child
+	parent.bouncerNets[msg.netID] = id
+
+	m.pushSysLine(parent.id, "_sys", fmt.Sprintf("-- bouncer network %s (%s) --", name, netState))
+	return tea.Batch(addListItemCmd(*child), connectServerCmd(id))
+}
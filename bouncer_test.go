@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lrstanley/girc"
+)
+
+func TestSASLConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		s         serverEntry
+		pass      string
+		want      string // mechanism, empty for none
+		wantIdent string
+	}{
+		{name: "plain server", s: serverEntry{nick: "me"}},
+		{name: "client cert", s: serverEntry{certFile: "me.pem"}, want: "EXTERNAL"},
+		{name: "bouncer password", s: serverEntry{nick: "me", user: "bob", bouncerID: "7"}, pass: "pw", want: "PLAIN", wantIdent: "bob"},
+		{name: "bouncer no password", s: serverEntry{nick: "me", bouncerID: "7"}},
+		{name: "bouncer client cert", s: serverEntry{nick: "me", bouncerID: "7", certFile: "me.pem"}, want: "EXTERNAL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mech := saslConfig(&tt.s, tt.pass)
+			switch {
+			case mech == nil && tt.want == "":
+			case mech == nil || mech.Method() != tt.want:
+				t.Fatalf("got %v, want %q", mech, tt.want)
+			}
+
+			if plain, ok := mech.(*girc.SASLPlain); ok && plain.User != tt.wantIdent {
+				t.Errorf("logs in as %q, want %q", plain.User, tt.wantIdent)
+			}
+		})
+	}
+}
+
+// TestBouncerBind walks a soju registration, BIND has to land between
+// the login and CAP END.
+func TestBouncerBind(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	s := &serverEntry{nick: "me", user: "bob", bouncerID: "7", queue: &sendQueue{}}
+	c := girc.New(girc.Config{
+		Server:        "test",
+		Nick:          "me",
+		User:          "bob",
+		PingDelay:     -1,
+		SASL:          saslConfig(s, "pw"),
+		SupportedCaps: supportedCaps(),
+	})
+	c.Handlers.Add(girc.RPL_LOGGEDIN, func(cl *girc.Client, _ girc.Event) {
+		bindBouncerNetwork(cl, s, floodConfig{})
+	})
+	go c.MockConnect(client)
+	defer c.Close()
+
+	sent := make(chan string, 32)
+	go func() {
+		sc := bufio.NewScanner(server)
+		for sc.Scan() {
+			sent <- sc.Text()
+		}
+	}()
+
+	reply := map[string]string{
+		"CAP REQ":            ":srv CAP * ACK :sasl",
+		"AUTHENTICATE PLAIN": "AUTHENTICATE +",
+		"AUTHENTICATE Ym9i":  ":srv 900 me me!bob@h bob :logged in\r\n:srv 903 me :SASL ok",
+	}
+	server.Write([]byte(":srv CAP * LS :sasl soju.im/bouncer-networks\r\n"))
+
+	var order []string
+	for {
+		select {
+		case ln := <-sent:
+			for prefix, r := range reply {
+				if strings.HasPrefix(ln, prefix) {
+					server.Write([]byte(r + "\r\n"))
+				}
+			}
+
+			if ln == "BOUNCER BIND 7" || ln == "CAP END" {
+				order = append(order, ln)
+			}
+			if ln == "CAP END" {
+				if len(order) != 2 || order[0] != "BOUNCER BIND 7" {
+					t.Errorf("sent %q", order)
+				}
+				return
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no CAP END, sent %q", order)
+		}
+	}
+}
+
+func TestBouncerNetworkRemoved(t *testing.T) {
+	m := newTestModel(t)
+	m.applyBouncerNetwork(bouncerNetworkMsg{id: 1, netID: "7", attrs: girc.Tags{"name": "libera", "state": "connected"}})
+
+	cid, ok := m.servers[1].bouncerNets["7"]
+	child := m.servers[cid]
+	if !ok || child == nil || child.bouncerID != "7" || child.name != "fake/libera" {
+		t.Fatalf("no bound entry for network 7: %+v", child)
+	}
+
+	m.applyBouncerNetwork(bouncerNetworkMsg{id: 1, netID: "7"})
+	if _, ok := m.servers[cid]; ok {
+		t.Error("entry kept after the network was removed")
+	}
+	if _, ok := m.servers[1].bouncerNets["7"]; ok {
+		t.Error("network id kept")
+	}
+	for _, it := range m.serverList.Items() {
+		if e, ok := it.(serverEntry); ok && e.id == cid {
+			t.Error("list row kept")
+		}
+	}
+	if len(m.deleted) != 0 {
+		t.Error("removed network is on the undo stack")
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lrstanley/girc"
+)
+
+// joinErrors are the numerics refusing a JOIN, with what to tell the user.
+var joinErrors = map[string]string{
+	girc.ERR_CHANNELISFULL:  "the channel is full (+l)",
+	girc.ERR_INVITEONLYCHAN: "the channel is invite only (+i)",
+	girc.ERR_BANNEDFROMCHAN: "you are banned (+b)",
+	girc.ERR_BADCHANNELKEY:  "wrong or missing key (+k)",
+	girc.ERR_NOCHANMODES:    "refused", // registered nicks only on most networks
+}
+
+// joinFailedMsg reports a channel we could not join.
+type joinFailedMsg struct {
+	id      serverID
+	channel string
+	code    string
+	text    string // server's own wording
+}
+
+// parseChanList reads the form's channel field,
+// entries are "#chan" or "#chan key".
+func parseChanList(field string) ([]string, map[string]string, error) {
+	var chans []string
+	keys := map[string]string{}
+	for _, entry := range splitList(field) {
+		ch, key, _ := strings.Cut(entry, " ")
+		if !girc.IsValidChannel(ch) {
+			return nil, nil, fmt.Errorf("invalid channel %q", ch)
+		}
+
+		chans = append(chans, ch)
+		if key = strings.TrimSpace(key); key != "" {
+			keys[ch] = key
+		}
+	}
+
+	return chans, keys, nil
+}
+
+// parseJoin reads "/join #a,#b keyA,keyB", keys pair up with channels in order.
+func parseJoin(arg string) (chans, keys []string) {
+	fields := strings.Fields(arg)
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	chans = splitList(fields[0])
+	if len(fields) > 1 {
+		keys = strings.Split(fields[1], ",")
+	}
+
+	return chans, keys
+}
+
+// joinChannel joins ch with its saved key, if any.
+func (m *model) joinChannel(s *serverEntry, ch string) {
+	key, err := m.secrets.expand(s.chanKeys[ch])
+	if err != nil {
+		m.pushSysLine(s.id, ch, "key for "+ch+": "+err.Error())
+		return
+	}
+
+	if key == "" {
+		m.sendLine(s, &girc.Event{Command: girc.JOIN, Params: []string{ch}})
+		return
+	}
+
+	m.sendLine(s, &girc.Event{Command: girc.JOIN, Params: []string{ch, key}, Sensitive: true})
+}
+
+// setChanKey remembers the key of ch for rejoining,
+// it goes into the secrets store when that is unlocked.
+func (m *model) setChanKey(s *serverEntry, ch, key string) string {
+	if key == "" {
+		return ""
+	}
+
+	key, note := m.sealSecret(chanKeyLabel(s, ch), key)
+	if s.chanKeys == nil {
+		s.chanKeys = map[string]string{}
+	}
+	s.chanKeys[ch] = key
+
+	return note
+}
+
+// dropChanKey forgets the key of ch, with the secret setChanKey made for it.
+func (m *model) dropChanKey(s *serverEntry, ch string) string {
+	ref := s.chanKeys[ch]
+	delete(s.chanKeys, ch)
+
+	name := secretName(chanKeyLabel(s, ch))
+	if ref != "${secret:"+name+"}" {
+		return ""
+	}
+	if _, err := m.secrets.del(name); err != nil {
+		return "secret: " + err.Error()
+	}
+
+	return ""
+}
+
+func chanKeyLabel(s *serverEntry, ch string) string {
+	return s.name + "-" + ch + "-key"
+}
+
+func handleJoinError(id serverID, e girc.Event) {
+	if len(e.Params) < 2 {
+		return
+	}
+
+	program.Send(joinFailedMsg{id: id, channel: e.Params[1], code: e.Command, text: e.Last()})
+}
+
+func (m *model) applyJoinFailed(msg joinFailedMsg) {
+	s, ok := m.servers[msg.id]
+	if !ok {
+		return
+	}
+
+	msg.channel = s.buffer(msg.channel)
+	delete(s.joined, msg.channel)
+	line := "!! cannot join " + msg.channel + ": " + joinErrors[msg.code]
+	if msg.text != "" {
+		line += " (" + msg.text + ")"
+	}
+
+	lines := []string{line}
+	switch {
+	case msg.code == girc.ERR_BADCHANNELKEY && s.chanKeys[msg.channel] != "":
+		lines = append(lines, "!! the saved key was refused, /join "+msg.channel+" <key> replaces it")
+	case msg.code == girc.ERR_BADCHANNELKEY:
+		lines = append(lines, "!! /join "+msg.channel+" <key> joins with a key")
+	case msg.code == girc.ERR_INVITEONLYCHAN:
+		lines = append(lines, "!! ask an operator for an invite, then /join "+msg.channel)
+	}
+
+	dest := []string{"_sys"}
+	if contains(s.channels, msg.channel) {
+		dest = append(dest, msg.channel)
+	}
+
+	for i, ch := range dest {
+		for _, l := range lines {
+			m.applyChanLine(ircChanLineMsg{id: s.id, channel: ch, line: stylePinkB.Render(l), mirror: i > 0})
+		}
+	}
+}
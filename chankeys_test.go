@@ -0,0 +1,98 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseChanList(t *testing.T) {
+	tests := []struct {
+		field   string
+		chans   []string
+		keys    map[string]string
+		wantErr bool
+	}{
+		{field: "", keys: map[string]string{}},
+		{field: "#a,#b", chans: []string{"#a", "#b"}, keys: map[string]string{}},
+		{field: " #a key , #b ", chans: []string{"#a", "#b"}, keys: map[string]string{"#a": "key"}},
+		{field: "#a k1,&b k2", chans: []string{"#a", "&b"}, keys: map[string]string{"#a": "k1", "&b": "k2"}},
+		{field: "#a,,#b", chans: []string{"#a", "#b"}, keys: map[string]string{}},
+		{field: "#a,nochan", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		chans, keys, err := parseChanList(tt.field)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: no error", tt.field)
+			}
+			continue
+		}
+
+		if err != nil || !reflect.DeepEqual(chans, tt.chans) || !reflect.DeepEqual(keys, tt.keys) {
+			t.Errorf("%q: got %q %q %v, want %q %q", tt.field, chans, keys, err, tt.chans, tt.keys)
+		}
+	}
+}
+
+func TestParseJoin(t *testing.T) {
+	tests := []struct {
+		arg         string
+		chans, keys []string
+	}{
+		{arg: ""},
+		{arg: "#a", chans: []string{"#a"}},
+		{arg: "#a,#b keyA,keyB", chans: []string{"#a", "#b"}, keys: []string{"keyA", "keyB"}},
+		{arg: "#a,#b,#c ,keyB", chans: []string{"#a", "#b", "#c"}, keys: []string{"", "keyB"}},
+		{arg: "  #a   key  ", chans: []string{"#a"}, keys: []string{"key"}},
+	}
+
+	for _, tt := range tests {
+		chans, keys := parseJoin(tt.arg)
+		if !reflect.DeepEqual(chans, tt.chans) || !reflect.DeepEqual(keys, tt.keys) {
+			t.Errorf("%q: got %q %q, want %q %q", tt.arg, chans, keys, tt.chans, tt.keys)
+		}
+	}
+}
+
+func TestModeKeyFollowed(t *testing.T) {
+	m := newTestModel(t, "#a")
+	m.secrets = &secretStore{path: filepath.Join(t.TempDir(), secretsFile)}
+	if err := m.secrets.unlock("passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	s := m.servers[1]
+
+	m.applyMode(modeMsg{id: 1, target: "#a", by: "op", modes: "+k", args: []string{"sekrit"}, at: time.Now()})
+	name := secretName("fake-#a-key")
+	if ref := s.chanKeys["#a"]; ref != "${secret:"+name+"}" {
+		t.Fatalf("key stored as %q", ref)
+	}
+	if v, err := m.secrets.get(name); err != nil || v != "sekrit" {
+		t.Errorf("secret %q, %v", v, err)
+	}
+	var shown []string
+	for _, ln := range s.channelLogs["#a"] {
+		shown = append(shown, ln.text)
+	}
+	if !strings.Contains(strings.Join(shown, "\n"), "stored as secret "+name) {
+		t.Errorf("no note in %q", shown)
+	}
+	if got := m.cfg.Servers; len(got) != 1 || got[0].ChanKeys["#a"] != s.chanKeys["#a"] {
+		t.Errorf("saved %+v", got)
+	}
+
+	m.applyMode(modeMsg{id: 1, target: "#a", by: "op", modes: "-k", args: []string{"*"}, at: time.Now()})
+	if _, ok := s.chanKeys["#a"]; ok {
+		t.Error("key kept after -k")
+	}
+	if _, err := m.secrets.get(name); err == nil {
+		t.Error("secret kept after -k")
+	}
+	if got := m.cfg.Servers; len(got) != 1 || len(got[0].ChanKeys) != 0 {
+		t.Errorf("saved %+v", got)
+	}
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/lrstanley/girc"
+)
+
+const chanListBatch = 500 // RPL_LIST entries per update of the browser
+
+// orders of the channel browser, cycled with SortList
+const (
+	sortUsers = iota
+	sortName
+	sortTopic
+	sortCount
+)
+
+var sortNames = [sortCount]string{"users", "name", "topic"}
+
+type chanListEntry struct {
+	name  string
+	users int
+	topic string
+}
+
+// chanListMsg carries RPL_LIST entries, done is set by RPL_LISTEND.
+// seq is the LIST request they answer.
+type chanListMsg struct {
+	id      serverID
+	seq     int
+	entries []chanListEntry
+	done    bool
+}
+
+// listRequests numbers the LIST requests of a connection. Servers answer
+// them in order, so the RPL_LISTENDs seen tell which one replies belong to.
+type listRequests struct {
+	mu   sync.Mutex
+	sent int
+	done int
+}
+
+func (r *listRequests) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent, r.done = 0, 0
+}
+
+// next numbers a request about to be sent.
+func (r *listRequests) next() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent++
+	return r.sent - 1
+}
+
+// answering is the request replies are coming in for.
+func (r *listRequests) answering() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.done
+}
+
+func (r *listRequests) end() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.done++
+}
+
+// chanListFilter is what /list asks for, the parts the server
+// can't filter (no ELIST support) are applied locally.
+type chanListFilter struct {
+	mask     string
+	minUsers int // -1 when unset
+	maxUsers int
+}
+
+// chanBrowser is the right pane opened by /list.
+type chanBrowser struct {
+	id      serverID
+	seq     int // LIST request shown, replies to earlier ones are dropped
+	entries []chanListEntry
+	local   chanListFilter
+	mask    *regexp.Regexp // local.mask, matched against case folded names
+	loading bool
+	sortBy  int
+	filter  textinput.Model
+	table   table.Model
+}
+
+func newChanBrowser() chanBrowser {
+	styles := table.DefaultStyles()
+	styles.Header = styles.Header.Foreground(pink).Bold(true)
+	styles.Selected = styleDarkSel.Bold(true)
+
+	return chanBrowser{
+		filter: newSearchInput(" > ", "fuzzy filter…"),
+		table:  table.New(table.WithStyles(styles), table.WithFocused(true)),
+	}
+}
+
+// addListHandlers collects RPL_LIST replies and forwards them in batches.
+func addListHandlers(c *girc.Client, id serverID, lists *listRequests) {
+	var mu sync.Mutex
+	var pending []chanListEntry
+	flush := func(done bool) {
+		mu.Lock()
+		entries := pending
+		pending = nil
+		mu.Unlock()
+		program.Send(chanListMsg{id: id, seq: lists.answering(), entries: entries, done: done})
+	}
+
+	c.Handlers.Add(girc.RPL_LIST, func(_ *girc.Client, e girc.Event) {
+		if len(e.Params) < 3 {
+			return
+		}
+
+		users, _ := strconv.Atoi(e.Params[2])
+		var topic string
+		if len(e.Params) > 3 {
+			topic = e.Last()
+		}
+
+		mu.Lock()
+		pending = append(pending, chanListEntry{name: e.Params[1], users: users, topic: topic})
+		full := len(pending) >= chanListBatch
+		mu.Unlock()
+		if full {
+			flush(false)
+		}
+	})
+	c.Handlers.Add(girc.RPL_LISTEND, func(_ *girc.Client, _ girc.Event) {
+		flush(true)
+		lists.end()
+	})
+}
+
+// parseListArgs reads "/list [mask] [>n] [<n] [text]", text prefills the
+// fuzzy filter.
+func parseListArgs(arg string) (chanListFilter, string) {
+	f := chanListFilter{minUsers: -1, maxUsers: -1}
+	var rest []string
+	for _, tok := range strings.Fields(arg) {
+		switch {
+		case len(tok) > 1 && (tok[0] == '>' || tok[0] == '<'):
+			n, err := strconv.Atoi(tok[1:])
+			if err != nil {
+				rest = append(rest, tok)
+			} else if tok[0] == '>' {
+				f.minUsers = n
+			} else {
+				f.maxUsers = n
+			}
+		case strings.ContainsAny(tok, "*?"):
+			f.mask = tok
+		default:
+			rest = append(rest, tok)
+		}
+	}
+
+	return f, strings.Join(rest, " ")
+}
+
+// chanListOpenMsg is /list, it changes the right pane so handleSlash
+// hands it over to Update.
+type chanListOpenMsg struct {
+	id  serverID
+	arg string
+}
+
+// listCmd sends LIST and opens the browser.
+func (m *model) listCmd(msg chanListOpenMsg) []string {
+	s, ok := m.servers[msg.id]
+	if !ok || s.client == nil || !s.connected {
+		return []string{"not connected"}
+	}
+
+	f, text := parseListArgs(msg.arg)
+	var params []string
+	local := chanListFilter{minUsers: -1, maxUsers: -1}
+	if f.mask != "" {
+		if s.support.hasEList('M') {
+			params = append(params, f.mask)
+		} else {
+			local.mask = f.mask
+		}
+	}
+
+	for _, n := range []struct {
+		v  int
+		op string
+	}{{f.minUsers, ">"}, {f.maxUsers, "<"}} {
+		if n.v < 0 {
+			continue
+		}
+
+		if s.support.hasEList('U') {
+			params = append(params, n.op+strconv.Itoa(n.v))
+		} else if n.op == ">" {
+			local.minUsers = n.v
+		} else {
+			local.maxUsers = n.v
+		}
+	}
+
+	list := &girc.Event{Command: girc.LIST}
+	if len(params) > 0 {
+		list.Params = []string{strings.Join(params, ",")}
+	}
+	m.sendLine(s, list)
+	seq := s.lists.next()
+
+	if m.mode != modeList {
+		m.prevMode = m.mode
+	}
+	m.blurRight()
+	m.mode = modeList
+	m.focus = paneRight
+
+	b := &m.chanList
+	b.id, b.seq, b.entries, b.local, b.loading = s.id, seq, nil, local, true
+	b.mask = nil
+	if local.mask != "" {
+		b.mask = maskRegexp(s.support.fold(local.mask))
+	}
+	b.filter.SetValue(text)
+	b.filter.Focus()
+	m.refreshChanList()
+	return nil
+}
+
+func (m *model) applyChanList(msg chanListMsg) {
+	b := &m.chanList
+	s, ok := m.servers[msg.id]
+	if !ok || msg.id != b.id || msg.seq != b.seq || !b.loading {
+		return
+	}
+
+	for _, e := range msg.entries {
+		if b.local.keep(e) && (b.mask == nil || b.mask.MatchString(s.support.fold(e.name))) {
+			b.entries = append(b.entries, e)
+		}
+	}
+
+	b.loading = !msg.done
+	if m.mode == modeList {
+		m.refreshChanList()
+	}
+}
+
+func (f chanListFilter) keep(e chanListEntry) bool {
+	if f.minUsers >= 0 && e.users <= f.minUsers {
+		return false
+	}
+
+	return f.maxUsers < 0 || e.users < f.maxUsers
+}
+
+// refreshChanList filters, sorts and lays out the table.
+func (m *model) refreshChanList() {
+	b := &m.chanList
+	shown := b.entries
+	if q := strings.TrimSpace(b.filter.Value()); q != "" {
+		targets := make([]string, len(b.entries))
+		for i, e := range b.entries {
+			targets[i] = e.name + " " + e.topic
+		}
+
+		shown = nil
+		for _, r := range list.DefaultFilter(q, targets) {
+			shown = append(shown, b.entries[r.Index])
+		}
+	} else {
+		shown = append([]chanListEntry(nil), shown...)
+	}
+
+	sort.SliceStable(shown, func(i, j int) bool {
+		a, c := shown[i], shown[j]
+		switch b.sortBy {
+		case sortName:
+			return strings.ToLower(a.name) < strings.ToLower(c.name)
+		case sortTopic:
+			return strings.ToLower(a.topic) < strings.ToLower(c.topic)
+		}
+		return a.users > c.users
+	})
+
+	width := (m.width - m.leftWidth) - 4 // inside the pane
+	nameW := min(max(width/4, 12), 30)
+	usersW := 6
+	topicW := max(width-nameW-usersW-6, 10) // cells are padded by one on each side
+	b.table.SetColumns([]table.Column{
+		{Title: "Channel", Width: nameW},
+		{Title: "Users", Width: usersW},
+		{Title: "Topic", Width: topicW},
+	})
+
+	rows := make([]table.Row, len(shown))
+	for i, e := range shown {
+		rows[i] = table.Row{e.name, fmt.Sprintf("%*d", usersW, e.users), e.topic}
+	}
+	b.table.SetRows(rows)
+	b.table.SetWidth(width)
+	b.table.SetHeight(max(m.height-8, 3))
+	if b.table.Cursor() >= len(rows) {
+		b.table.SetCursor(max(len(rows)-1, 0))
+	}
+}
+
+func (m model) updateChanList(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	b := &m.chanList
+	switch {
+	case key.Matches(msg, m.keys.Back):
+		b.filter.Blur()
+		b.loading = false
+		m.mode = m.prevMode
+		if m.mode == modeChat && m.activeID == 0 {
+			m.mode = modeForm
+		}
+		m.focusRight()
+		return m, nil
+	case key.Matches(msg, m.keys.SortList):
+		b.sortBy = (b.sortBy + 1) % sortCount
+		b.table.SetCursor(0)
+		m.refreshChanList()
+		return m, nil
+	case key.Matches(msg, m.keys.ScrollUp):
+		b.table.MoveUp(1)
+		return m, nil
+	case key.Matches(msg, m.keys.ScrollDown):
+		b.table.MoveDown(1)
+		return m, nil
+	case key.Matches(msg, m.keys.PageUp):
+		b.table.MoveUp(b.table.Height() / 2)
+		return m, nil
+	case key.Matches(msg, m.keys.PageDown):
+		b.table.MoveDown(b.table.Height() / 2)
+		return m, nil
+	case key.Matches(msg, m.keys.Select):
+		row := b.table.SelectedRow()
+		s, ok := m.servers[b.id]
+		if row == nil || !ok {
+			return m, nil
+		}
+
+		b.filter.Blur()
+		b.loading = false
+		m.mode, m.activeID, m.activeChan = modeChat, s.id, s.buffer(row[0])
+		cmd := m.handleSlash(s, "/join "+row[0])
+		m.focusRight()
+		m.refreshChat()
+		return m, cmd
+	}
+
+	prev := b.filter.Value()
+	var cmd tea.Cmd
+	b.filter, cmd = b.filter.Update(msg)
+	if b.filter.Value() != prev {
+		b.table.SetCursor(0)
+		m.refreshChanList()
+	}
+	return m, cmd
+}
+
+func (m model) viewChanList() string {
+	b := m.chanList
+	title := " Channels"
+	if s, ok := m.servers[b.id]; ok {
+		title += " on " + s.name
+	}
+
+	status := plural(len(b.table.Rows()), "channel") + " · sorted by " + sortNames[b.sortBy]
+	if b.loading {
+		status += " · loading…"
+	}
+
+	var sb strings.Builder
+	sb.WriteString(stylePinkB.Render(title) + "\n\n")
+	sb.WriteString(b.filter.View() + "\n\n")
+	sb.WriteString(styleDim.Render(status) + "\n")
+	sb.WriteString(b.table.View() + "\n")
+	sb.WriteString(styleDim.Render("enter join · " + m.keys.SortList.Help().Key + " sort · " + m.keys.Back.Help().Key + " back"))
+	return sb.String()
+}
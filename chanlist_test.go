@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lrstanley/girc"
+)
+
+func TestParseListArgs(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want chanListFilter
+		rest string
+	}{
+		{arg: "", want: chanListFilter{minUsers: -1, maxUsers: -1}},
+		{arg: ">50", want: chanListFilter{minUsers: 50, maxUsers: -1}},
+		{arg: "<10 >2", want: chanListFilter{minUsers: 2, maxUsers: 10}},
+		{arg: "#go*", want: chanListFilter{mask: "#go*", minUsers: -1, maxUsers: -1}},
+		{arg: "*rust? >5", want: chanListFilter{mask: "*rust?", minUsers: 5, maxUsers: -1}},
+		{arg: "#a,#b", want: chanListFilter{minUsers: -1, maxUsers: -1}, rest: "#a,#b"},
+		{arg: ">x <", want: chanListFilter{minUsers: -1, maxUsers: -1}, rest: ">x <"},
+		{arg: "C>60 >3", want: chanListFilter{minUsers: 3, maxUsers: -1}, rest: "C>60"},
+	}
+
+	for _, tt := range tests {
+		f, rest := parseListArgs(tt.arg)
+		if f != tt.want || rest != tt.rest {
+			t.Errorf("%q: got %+v %q, want %+v %q", tt.arg, f, rest, tt.want, tt.rest)
+		}
+	}
+}
+
+func TestChanListReplies(t *testing.T) {
+	m := newTestModel(t)
+	s := m.servers[1]
+	s.client = girc.New(girc.Config{Server: "test", Nick: "me", User: "me"})
+	s.connected = true
+	m.cfg.Flood = floodConfig{IntervalMs: 60_000}
+	s.queue.filled, s.queue.tokens = time.Now(), 0
+	defer s.queue.cancel()
+
+	// the first /list is still answering when the second one is sent
+	m.listCmd(chanListOpenMsg{id: 1, arg: "#old*"})
+	m.listCmd(chanListOpenMsg{id: 1, arg: "#go{*"})
+	for _, msg := range []chanListMsg{
+		{id: 1, seq: 0, entries: []chanListEntry{{name: "#old", users: 3}}},
+		{id: 1, seq: 0, done: true},
+		{id: 1, seq: 1, entries: []chanListEntry{
+			{name: "#GO[dev]", users: 9}, // rfc1459 folds [ to {
+			{name: "#go{x}", users: 5},
+			{name: "#golang", users: 7},
+			{name: "#rust", users: 1},
+		}},
+	} {
+		m.applyChanList(msg)
+	}
+
+	var got []string
+	for _, e := range m.chanList.entries {
+		got = append(got, e.name)
+	}
+	if strings.Join(got, " ") != "#GO[dev] #go{x}" {
+		t.Errorf("browser has %q", got)
+	}
+	if !m.chanList.loading {
+		t.Error("the earlier RPL_LISTEND ended loading")
+	}
+
+	m.applyChanList(chanListMsg{id: 1, seq: 1, done: true})
+	if m.chanList.loading {
+		t.Error("still loading after RPL_LISTEND")
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+const logTimeFormat = "2006-01-02 15:04:05"
+
+// chatLogger appends plain-text buffer lines to
+// <dir>/<server>/<channel>.log, one file per buffer.
+type chatLogger struct {
+	dir   string
+	files map[string]*os.File
+}
+
+func newChatLogger(dir string) *chatLogger {
+	return &chatLogger{dir: dir, files: map[string]*os.File{}}
+}
+
+func (l *chatLogger) write(server, channel, line string, at time.Time) {
+	path := logFilePath(l.dir, server, channel)
+	f, ok := l.files[path]
+	if !ok {
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			log.Println("chat log:", err)
+			return
+		}
+
+		var err error
+		f, err = os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			log.Println("chat log:", err)
+			return
+		}
+		l.files[path] = f
+	}
+
+	ts := at.Local().Format(logTimeFormat)
+	for _, ln := range strings.Split(ansi.Strip(line), "\n") {
+		if strings.TrimSpace(ln) == "" {
+			continue
+		}
+
+		if _, err := f.WriteString(ts + " " + ln + "\n"); err != nil {
+			log.Println("chat log:", err)
+			return
+		}
+	}
+}
+
+func (l *chatLogger) close() {
+	for _, f := range l.files {
+		f.Close()
+	}
+}
+
+func logFilePath(dir, server, channel string) string {
+	if channel == "" {
+		channel = "_sys"
+	}
+
+	return filepath.Join(dir, safeFileName(server), safeFileName(channel)+".log")
+}
+
+// safeFileName escapes what can't be part of a file name as %XX, and %
+// itself, so search can tell the server and buffer from the log path.
+func safeFileName(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '/', '\\', ':', '%', 0:
+			fmt.Fprintf(&b, "%%%02X", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+// fileNameOf reverses safeFileName, names it didn't make come back as they are.
+func fileNameOf(name string) string {
+	if s, err := url.PathUnescape(name); err == nil {
+		return s
+	}
+
+	return name
+}
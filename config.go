@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const configEnv = "CLIRC_CONFIG"
+
+type keysConfig struct {
+	Preset   string              `json:"preset,omitempty"`   // default, vim or emacs
+	Bindings map[string][]string `json:"bindings,omitempty"` // action => keys
+}
+
+type config struct {
+	Keys         keysConfig              `json:"keys"`
+	QuitMessage  string                  `json:"quit_message,omitempty"`
+	LogDir       string                  `json:"log_dir,omitempty"` // chat logs, disabled when empty
+	DisableMouse bool                    `json:"disable_mouse,omitempty"`
+	Presence     presenceConfig          `json:"presence"`
+	Lag          lagConfig               `json:"lag"`
+	Flood        floodConfig             `json:"flood"`
+	Ignores      map[string][]ignoreRule `json:"ignores,omitempty"`     // server name => rules
+	TLSPins      map[string]string       `json:"tls_pins,omitempty"`    // host:port => SHA-256 of the certificate
+	Proxy        string                  `json:"proxy,omitempty"`       // default proxy URL for new servers
+	AutoRejoin   bool                    `json:"auto_rejoin,omitempty"` // join again after being kicked
+	RecordDir    string                  `json:"record_dir,omitempty"`  // raw session recordings for "clirc replay"
+	Servers      []formCfg               `json:"servers,omitempty"`
+
+	PassphraseCommand string `json:"passphrase_command,omitempty"` // prints the secrets passphrase, e.g. "pass show clirc"
+
+	readOnly bool // never saved, set while replaying
+}
+
+// configPath returns the config file location,
+// $CLIRC_CONFIG wins over the user config dir.
+func configPath() (string, error) {
+	if p := os.Getenv(configEnv); p != "" {
+		return p, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "clirc", "config.json"), nil
+}
+
+// loadConfig reads the config file.
+// A missing file is not an error and yields the zero config.
+func loadConfig() (config, error) {
+	var cfg config
+	path, err := configPath()
+	if err != nil {
+		return cfg, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	} else if err != nil {
+		return cfg, err
+	}
+
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+func saveConfig(cfg config) error {
+	if cfg.readOnly {
+		return nil
+	}
+
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/lrstanley/girc"
+)
+
+const (
+	defaultQuitMessage = "bye"
+	shutdownTimeout    = 2 * time.Second
+	maxUndo            = 10
+)
+
+type shutdownDoneMsg struct{}
+
+// confirmDialog is a modal yes/no prompt.
+// While it is open it receives every key press.
+type confirmDialog struct {
+	title  string
+	prompt string
+	yes    func(m *model) tea.Cmd
+	no     func(m *model) tea.Cmd // optional
+}
+
+// deletedServer keeps what's needed to undo a server deletion.
+type deletedServer struct {
+	entry *serverEntry
+	items []serverEntry // list rows in their original order
+	index int           // position of the first row
+}
+
+func (m *model) openConfirm(title, prompt string, yes func(m *model) tea.Cmd) {
+	m.confirm = &confirmDialog{title: title, prompt: prompt, yes: yes}
+}
+
+// updateConfirm handles a key press while the dialog is open.
+func (m model) updateConfirm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case key.Matches(msg, m.keys.Confirm):
+		d := m.confirm
+		m.confirm = nil
+		return m, d.yes(&m)
+	case key.Matches(msg, m.keys.Cancel):
+		d := m.confirm
+		m.confirm = nil
+		if d.no != nil {
+			return m, d.no(&m)
+		}
+	}
+
+	return m, nil
+}
+
+func (m model) viewConfirm() string {
+	body := lipgloss.JoinVertical(
+		lipgloss.Left,
+		stylePinkB.Render(m.confirm.title),
+		"",
+		stylePink.Render(m.confirm.prompt),
+		"",
+		styleDim.Render(m.keys.Confirm.Help().Key+" "+m.keys.Confirm.Help().Desc+
+			" · "+m.keys.Cancel.Help().Key+" "+m.keys.Cancel.Help().Desc),
+	)
+
+	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, box.Padding(1, 2).Render(body))
+}
+
+// requestQuit asks before leaving, connected servers get a proper QUIT.
+func (m *model) requestQuit() {
+	prompt := "Leave clirc?"
+	if n := len(m.connectedClients()); n > 0 {
+		prompt = "Disconnect from " + plural(n, "server") + " and leave clirc?"
+	}
+
+	m.openConfirm("Quit", prompt, func(m *model) tea.Cmd {
+		m.shuttingDown = true
+		return shutdownCmd(m.connectedClients(), m.quitMessage)
+	})
+}
+
+// requestDelete asks before removing a server with all of its channels.
+func (m *model) requestDelete(id serverID) {
+	s, ok := m.servers[id]
+	if !ok {
+		return
+	}
+
+	prompt := "Delete " + s.name + " (" + s.address + ")?"
+	if s.connected {
+		prompt = "Disconnect and delete " + s.name + " (" + s.address + ")?"
+	}
+
+	m.openConfirm("Delete server", prompt, func(m *model) tea.Cmd {
+		m.deleteServer(id)
+		return nil
+	})
+}
+
+func (m *model) connectedClients() []*girc.Client {
+	var clients []*girc.Client
+	for _, s := range m.servers {
+		if s.client != nil && s.connected {
+			clients = append(clients, s.client)
+		}
+	}
+
+	return clients
+}
+
+// shutdownCmd sends QUIT to every client and waits
+// until they are gone or the timeout passes.
+func shutdownCmd(clients []*girc.Client, reason string) tea.Cmd {
+	return func() tea.Msg {
+		for _, c := range clients {
+			c.Quit(reason)
+		}
+
+		deadline := time.Now().Add(shutdownTimeout)
+		for time.Now().Before(deadline) {
+			open := false
+			for _, c := range clients {
+				if c.IsConnected() {
+					open = true
+					break
+				}
+			}
+
+			if !open {
+				break
+			}
+
+			time.Sleep(50 * time.Millisecond)
+		}
+
+		for _, c := range clients {
+			c.Close()
+		}
+
+		return shutdownDoneMsg{}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func pressKey(m model, s string) (model, tea.Cmd) {
+	next, cmd := m.Update(press(s))
+	return next.(model), cmd
+}
+
+// confirmTestModel has two saved servers and the server list focused on
+// the second one.
+func confirmTestModel(t *testing.T) model {
+	t.Helper()
+	m := newTestModel(t)
+	s := newServerEntry(2, formCfg{Name: "other", Address: "127.0.0.1:6668", Nick: "me"})
+	m.servers[2] = s
+	m.nextID = 3
+	m.serverList.SetItems(append(append(m.servers[1].listItems(), s.listItems()...), addServerItem{}))
+	m.serverList.Select(1)
+	m.focus = paneServers
+	m.saveServers()
+	return m
+}
+
+func serverNames(m model) []string {
+	var names []string
+	for _, it := range m.serverList.Items() {
+		if e, ok := it.(serverEntry); ok {
+			names = append(names, e.name)
+		}
+	}
+
+	return names
+}
+
+func TestConfirmDelete(t *testing.T) {
+	m := confirmTestModel(t)
+
+	m, _ = pressKey(m, "d")
+	if m.confirm == nil || m.confirm.prompt != "Delete other (127.0.0.1:6668)?" {
+		t.Fatalf("dialog %+v", m.confirm)
+	}
+
+	// the dialog takes every key, "a" doesn't open the form behind it
+	m, _ = pressKey(m, "a")
+	if m.confirm == nil || m.focus != paneServers {
+		t.Fatal("key went past the dialog")
+	}
+
+	for _, cancel := range []string{"n", "esc"} {
+		m, _ = pressKey(m, cancel)
+		if m.confirm != nil || m.servers[2] == nil {
+			t.Fatalf("%s: dialog %v, server kept %v", cancel, m.confirm != nil, m.servers[2] != nil)
+		}
+		m, _ = pressKey(m, "d")
+	}
+
+	m, _ = pressKey(m, "y")
+	if m.confirm != nil || m.servers[2] != nil || len(m.deleted) != 1 {
+		t.Fatalf("not deleted: dialog %v, %d undoable", m.confirm != nil, len(m.deleted))
+	}
+	if got := serverNames(m); len(got) != 1 || got[0] != "fake" {
+		t.Errorf("list %q", got)
+	}
+	if got := m.cfg.Servers; len(got) != 1 || got[0].Name != "fake" {
+		t.Errorf("saved %+v", got)
+	}
+}
+
+func TestUndoDelete(t *testing.T) {
+	m := confirmTestModel(t)
+	if m.undoDelete() != nil {
+		t.Error("undo with nothing deleted")
+	}
+
+	m.servers[2].joined["#a"] = true
+	m.serverList.Select(0)
+	m.deleteServer(2)
+	m.deleteServer(1)
+
+	m, cmd := pressKey(m, "u")
+	if cmd == nil || m.servers[1] == nil || m.servers[2] != nil {
+		t.Fatalf("undo restored %v, reconnect %v", m.servers[1] != nil, cmd != nil)
+	}
+	m, _ = pressKey(m, "u")
+	s := m.servers[2]
+	if s == nil || s.client != nil || s.connected || len(s.joined) != 0 {
+		t.Fatalf("restored %+v", s)
+	}
+
+	// back in their old places, the last one restored selected
+	if got := serverNames(m); len(got) != 2 || got[0] != "fake" || got[1] != "other" {
+		t.Errorf("list %q", got)
+	}
+	if e, ok := m.serverList.SelectedItem().(serverEntry); !ok || e.id != 2 {
+		t.Errorf("selected %v", m.serverList.SelectedItem())
+	}
+	if got := m.cfg.Servers; len(got) != 2 || got[0].Name != "fake" || got[1].Name != "other" {
+		t.Errorf("saved %+v", got)
+	}
+	if len(m.deleted) != 0 {
+		t.Errorf("%d left to undo", len(m.deleted))
+	}
+}
+
+func TestUndoLimit(t *testing.T) {
+	m := newTestModel(t)
+	for id := serverID(2); id < 2+maxUndo+2; id++ {
+		m.servers[id] = newServerEntry(id, formCfg{Name: "s", Address: "127.0.0.1:6667", Nick: "me"})
+		m.deleteServer(id)
+	}
+
+	if len(m.deleted) != maxUndo || m.deleted[0].entry.id != 4 {
+		t.Errorf("%d undoable, oldest %d", len(m.deleted), m.deleted[0].entry.id)
+	}
+}
+
+func TestConfirmQuit(t *testing.T) {
+	m := newTestModel(t)
+
+	m, _ = pressKey(m, "ctrl+c")
+	if m.confirm == nil || m.confirm.prompt != "Leave clirc?" {
+		t.Fatalf("dialog %+v", m.confirm)
+	}
+	m, _ = pressKey(m, "n")
+	if m.confirm != nil || m.shuttingDown {
+		t.Fatal("cancel didn't close the dialog")
+	}
+
+	m, _ = pressKey(m, "ctrl+c")
+	m, cmd := pressKey(m, "y")
+	if !m.shuttingDown || cmd == nil {
+		t.Fatal("confirm didn't shut down")
+	}
+	if _, ok := cmd().(shutdownDoneMsg); !ok {
+		t.Error("shutdown didn't finish")
+	}
+
+	// a second quit while waiting leaves at once
+	if _, cmd := pressKey(m, "ctrl+c"); cmd == nil {
+		t.Error("second quit ignored")
+	} else if _, ok := cmd().(tea.QuitMsg); !ok {
+		t.Error("second quit doesn't leave")
+	}
+}
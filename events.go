@@ -0,0 +1,311 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/lrstanley/girc"
+)
+
+const rejoinDelay = 3 * time.Second
+
+// kickMsg is someone, maybe us, being kicked from a channel.
+type kickMsg struct {
+	id      serverID
+	channel string
+	nick    string
+	by      string
+	reason  string
+	at      time.Time
+}
+
+// modeMsg is a MODE change of a channel or of our own nick.
+type modeMsg struct {
+	id     serverID
+	target string
+	by     string
+	modes  string
+	args   []string
+	at     time.Time
+}
+
+type inviteMsg struct {
+	id      serverID
+	channel string
+	by      string
+	source  string
+	at      time.Time
+}
+
+// topicMsg is a live TOPIC change, RPL_TOPIC is shown on join.
+type topicMsg struct {
+	id      serverID
+	channel string
+	by      string
+	topic   string
+	at      time.Time
+}
+
+// rejoinMsg joins a channel again after we were kicked.
+type rejoinMsg struct {
+	id      serverID
+	channel string
+}
+
+// pendingInvite is the last invite, AcceptInvite joins it.
+type pendingInvite struct {
+	id      serverID
+	channel string
+}
+
+type modeChange struct {
+	add  bool
+	mode byte
+	arg  string
+}
+
+// modeTakesArg reports whether a channel mode carries a parameter,
+// following CHANMODES and PREFIX.
+func (i *isupport) modeTakesArg(mode byte, add bool) bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	switch {
+	case strings.IndexByte(i.prefixModes, mode) >= 0,
+		strings.IndexByte(i.chanModes[0], mode) >= 0,
+		strings.IndexByte(i.chanModes[1], mode) >= 0:
+		return true
+	case strings.IndexByte(i.chanModes[2], mode) >= 0:
+		return add
+	}
+
+	return false
+}
+
+// isSetting reports whether a channel mode is a setting of the channel
+// rather than a list entry or a nick prefix.
+func (i *isupport) isSetting(mode byte) bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return strings.IndexByte(i.prefixModes, mode) < 0 && strings.IndexByte(i.chanModes[0], mode) < 0
+}
+
+// parseModes pairs a mode string like "+ok-v nick key nick" with its parameters.
+func (i *isupport) parseModes(modes string, args []string) []modeChange {
+	var out []modeChange
+	add := true
+	for n := 0; n < len(modes); n++ {
+		switch c := modes[n]; c {
+		case '+', '-':
+			add = c == '+'
+		default:
+			mc := modeChange{add: add, mode: c}
+			if i.modeTakesArg(c, add) && len(args) > 0 {
+				mc.arg, args = args[0], args[1:]
+			}
+			out = append(out, mc)
+		}
+	}
+
+	return out
+}
+
+// addEventHandlers forwards the channel events that are not numerics.
+func addEventHandlers(c *girc.Client, id serverID) {
+	c.Handlers.Add(girc.KICK, func(_ *girc.Client, e girc.Event) {
+		if e.Source == nil || len(e.Params) < 2 {
+			return
+		}
+
+		var reason string
+		if len(e.Params) > 2 {
+			reason = e.Last()
+		}
+
+		program.Send(kickMsg{id: id, channel: e.Params[0], nick: e.Params[1], by: e.Source.Name, reason: reason, at: e.Timestamp})
+	})
+	c.Handlers.Add(girc.MODE, func(_ *girc.Client, e girc.Event) {
+		if e.Source == nil || len(e.Params) < 2 {
+			return
+		}
+
+		program.Send(modeMsg{id: id, target: e.Params[0], by: e.Source.Name, modes: e.Params[1], args: e.Params[2:], at: e.Timestamp})
+	})
+	c.Handlers.Add(girc.INVITE, func(_ *girc.Client, e girc.Event) {
+		if e.Source == nil || len(e.Params) < 2 {
+			return
+		}
+
+		program.Send(inviteMsg{id: id, channel: e.Params[1], by: e.Source.Name, source: e.Source.String(), at: e.Timestamp})
+	})
+	c.Handlers.Add(girc.TOPIC, func(_ *girc.Client, e girc.Event) {
+		if e.Source == nil || len(e.Params) < 1 {
+			return
+		}
+
+		var topic string
+		if len(e.Params) > 1 {
+			topic = e.Last()
+		}
+
+		program.Send(topicMsg{id: id, channel: e.Params[0], by: e.Source.Name, topic: topic, at: e.Timestamp})
+	})
+}
+
+func (m *model) applyKick(msg kickMsg) tea.Cmd {
+	s, ok := m.servers[msg.id]
+	if !ok {
+		return nil
+	}
+
+	ch := s.buffer(msg.channel)
+	line := fmt.Sprintf("[%s] * %s was kicked by %s", stamp(msg.at), msg.nick, msg.by)
+	if msg.reason != "" {
+		line += " (" + msg.reason + ")"
+	}
+
+	if !s.isMe(msg.nick) {
+		delete(s.members[ch], msg.nick)
+		m.applyChanLine(ircChanLineMsg{id: s.id, channel: ch, line: styleDim.Render(line), at: msg.at})
+		return nil
+	}
+
+	delete(s.joined, ch)
+	delete(s.members, ch)
+	for _, dest := range []string{ch, "_sys"} {
+		m.applyChanLine(ircChanLineMsg{id: s.id, channel: dest, line: stylePinkB.Render(line), at: msg.at, mirror: dest == "_sys"})
+	}
+
+	if !m.cfg.AutoRejoin {
+		m.pushSysLine(s.id, ch, "-- /join "+ch+" to rejoin --")
+		return nil
+	}
+
+	m.pushSysLine(s.id, ch, "-- rejoining in "+rejoinDelay.String()+" --")
+	return tea.Tick(rejoinDelay, func(time.Time) tea.Msg {
+		return rejoinMsg{id: s.id, channel: ch}
+	})
+}
+
+func (m *model) applyRejoin(msg rejoinMsg) {
+	s, ok := m.servers[msg.id]
+	if !ok || s.client == nil || !s.connected || s.joined[msg.channel] {
+		return
+	}
+
+	m.joinChannel(s, msg.channel)
+}
+
+func (m *model) applyMode(msg modeMsg) {
+	s, ok := m.servers[msg.id]
+	if !ok {
+		return
+	}
+
+	text := strings.TrimSpace(msg.modes + " " + strings.Join(msg.args, " "))
+	if !s.support.isChannel(msg.target) {
+		m.applyChanLine(ircChanLineMsg{id: s.id, channel: "_sys", line: styleDim.Render(fmt.Sprintf("[%s] * %s sets user mode %s", stamp(msg.at), msg.by, text)), at: msg.at})
+		return
+	}
+
+	ch := s.buffer(msg.target)
+	changes := s.support.parseModes(msg.modes, msg.args)
+	s.info(ch).applyModes(s.support, changes)
+	var notes []string
+	keyChanged := false
+	for _, mc := range changes {
+		// follow key changes so a rejoin still gets in
+		if mc.mode != 'k' || !contains(s.channels, ch) {
+			continue
+		}
+
+		note := ""
+		switch {
+		case mc.add && mc.arg != "" && mc.arg != "*":
+			note = m.setChanKey(s, ch, mc.arg)
+		case !mc.add:
+			note = m.dropChanKey(s, ch)
+		default:
+			continue
+		}
+		if note != "" {
+			notes = append(notes, note)
+		}
+		keyChanged = true
+	}
+
+	m.applyChanLine(ircChanLineMsg{id: s.id, channel: ch, line: styleDim.Render(fmt.Sprintf("[%s] * %s sets mode %s", stamp(msg.at), msg.by, text)), at: msg.at})
+	for _, n := range notes {
+		m.pushSysLine(s.id, ch, n)
+	}
+	if keyChanged {
+		m.saveServers()
+	}
+}
+
+func (m *model) applyInvite(msg inviteMsg) {
+	s, ok := m.servers[msg.id]
+	if !ok || m.ignored(s, msg.source, classInvites) {
+		return
+	}
+
+	m.invite = &pendingInvite{id: s.id, channel: msg.channel}
+	line := stylePinkB.Render(fmt.Sprintf("[%s] * %s invites you to %s, %s joins", stamp(msg.at), msg.by, msg.channel, m.keys.AcceptInvite.Help().Key))
+	m.applyChanLine(ircChanLineMsg{id: s.id, channel: "_sys", line: line, at: msg.at})
+	if m.activeID == s.id && m.activeChan != "_sys" {
+		m.applyChanLine(ircChanLineMsg{id: s.id, channel: m.activeChan, line: line, at: msg.at, mirror: true})
+	}
+}
+
+// acceptInvite joins the channel of the last invite.
+func (m *model) acceptInvite() tea.Cmd {
+	inv := m.invite
+	m.invite = nil
+	s, ok := m.servers[inv.id]
+	if !ok {
+		return nil
+	}
+
+	m.mode, m.activeID, m.activeChan = modeChat, s.id, s.buffer(inv.channel)
+	cmd := m.handleSlash(s, "/join "+inv.channel)
+	m.refreshChat()
+	return cmd
+}
+
+func (m *model) applyTopic(msg topicMsg) {
+	s, ok := m.servers[msg.id]
+	if !ok {
+		return
+	}
+
+	info := s.info(msg.channel)
+	info.topic, info.setBy, info.setAt = msg.topic, msg.by, msg.at
+
+	line := fmt.Sprintf("[%s] * %s changed the topic to: %s", stamp(msg.at), msg.by, msg.topic)
+	if msg.topic == "" {
+		line = fmt.Sprintf("[%s] * %s cleared the topic", stamp(msg.at), msg.by)
+	}
+
+	m.applyChanLine(ircChanLineMsg{id: s.id, channel: msg.channel, line: styleDim.Render(line), at: msg.at})
+}
+
+// renameMember moves a nick in the roster and returns the channels it is in.
+func (s *serverEntry) renameMember(old, nick string) []string {
+	var chans []string
+	for ch, nicks := range s.members {
+		if !nicks[old] {
+			continue
+		}
+
+		delete(nicks, old)
+		nicks[nick] = true
+		if t, ok := s.lastSpoke[ch][old]; ok {
+			delete(s.lastSpoke[ch], old)
+			s.lastSpoke[ch][nick] = t
+		}
+		chans = append(chans, ch)
+	}
+
+	return chans
+}
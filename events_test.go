@@ -0,0 +1,67 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseModes(t *testing.T) {
+	tests := []struct {
+		name      string
+		chanModes string // CHANMODES, empty for the defaults
+		modes     string
+		args      []string
+		want      []modeChange
+	}{
+		{
+			name:  "prefix and key pair up",
+			modes: "+ok-v", args: []string{"bob", "sekrit", "eve"},
+			want: []modeChange{{true, 'o', "bob"}, {true, 'k', "sekrit"}, {false, 'v', "eve"}},
+		},
+		{
+			name:  "limit only takes a parameter when set",
+			modes: "+l-l+o", args: []string{"10", "bob"},
+			want: []modeChange{{true, 'l', "10"}, {false, 'l', ""}, {true, 'o', "bob"}},
+		},
+		{
+			name:  "settings take none",
+			modes: "+nt-s",
+			want:  []modeChange{{true, 'n', ""}, {true, 't', ""}, {false, 's', ""}},
+		},
+		{
+			name:  "list modes always do",
+			modes: "-b+I", args: []string{"*!*@bad", "*!*@good"},
+			want: []modeChange{{false, 'b', "*!*@bad"}, {true, 'I', "*!*@good"}},
+		},
+		{
+			name:  "missing parameters",
+			modes: "+ov", args: []string{"bob"},
+			want: []modeChange{{true, 'o', "bob"}, {true, 'v', ""}},
+		},
+		{
+			name:      "CHANMODES moves modes between classes",
+			chanModes: "beIq,kf,lj,imnpst",
+			modes:     "+qf-j+k", args: []string{"*!*@x", "5:10", "key"},
+			want: []modeChange{{true, 'q', "*!*@x"}, {true, 'f', "5:10"}, {false, 'j', ""}, {true, 'k', "key"}},
+		},
+		{
+			name:      "a mode CHANMODES doesn't list takes none",
+			chanModes: "b,,,nt",
+			modes:     "+kb", args: []string{"*!*@x"},
+			want: []modeChange{{true, 'k', ""}, {true, 'b', "*!*@x"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := newISupport()
+			if tt.chanModes != "" {
+				is.parse([]string{"CHANMODES=" + tt.chanModes})
+			}
+
+			if got := is.parseModes(tt.modes, tt.args); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
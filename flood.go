@@ -0,0 +1,303 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lrstanley/girc"
+)
+
+const queuePreview = 5 // pending lines listed by /queue
+
+type floodConfig struct {
+	Burst      int  `json:"burst,omitempty"`       // lines sent without waiting, 5 by default
+	IntervalMs int  `json:"interval_ms,omitempty"` // then one line per interval, 2000 by default
+	Disabled   bool `json:"disabled,omitempty"`    // leave pacing to girc
+}
+
+func (c floodConfig) burst() float64 {
+	if c.Burst > 0 {
+		return float64(c.Burst)
+	}
+
+	return 5
+}
+
+func (c floodConfig) interval() time.Duration {
+	if c.IntervalMs > 0 {
+		return time.Duration(c.IntervalMs) * time.Millisecond
+	}
+
+	return 2 * time.Second
+}
+
+type queuedLine struct {
+	c *girc.Client
+	e *girc.Event
+}
+
+// sendQueue paces what we send to a server with a token bucket. It is
+// shared by the entry and its list items, lines leave from its own
+// goroutine so the UI never waits on them.
+type sendQueue struct {
+	id      serverID
+	mu      sync.Mutex
+	pending []queuedLine
+	tokens  float64
+	filled  time.Time // tokens last topped up, zero for a full bucket
+	running bool
+	active  time.Time // the last line out that wasn't a PING, PONG or WHO
+}
+
+// sendLineMsg is a line from a connection handler or a timer, Update
+// sends it through the flood control of the server.
+type sendLineMsg struct {
+	id     serverID
+	client *girc.Client // the connection it is meant for
+	e      *girc.Event
+}
+
+// sendFromHandler hands a line for c to Update, the handlers of c must
+// not touch the model.
+func sendFromHandler(c *girc.Client, id serverID, e *girc.Event) {
+	program.Send(sendLineMsg{id: id, client: c, e: e})
+}
+
+// sendQueueMsg tells the UI a queued line went out.
+type sendQueueMsg struct {
+	id serverID
+	e  *girc.Event
+}
+
+// send queues e for c, it goes out right away while the bucket has tokens.
+// sent is true when flood control is off and e went out already.
+func (q *sendQueue) send(cfg floodConfig, c *girc.Client, e *girc.Event) (sent bool) {
+	if cfg.Disabled {
+		q.out(c, e)
+		return true
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending = append(q.pending, queuedLine{c: c, e: e})
+	if !q.running {
+		q.running = true
+		go q.run(cfg)
+	}
+	return false
+}
+
+// sendFirst sends e for c from a handler right away while nothing waits
+// and the bucket has a token, registration lines have to keep their place
+// among the ones girc sends. Otherwise e waits its turn like any other.
+func (q *sendQueue) sendFirst(cfg floodConfig, c *girc.Client, e *girc.Event) {
+	q.mu.Lock()
+	now := cfg.Disabled || (len(q.pending) == 0 && q.take(cfg) == 0)
+	q.mu.Unlock()
+	if now {
+		q.out(c, e)
+		return
+	}
+
+	q.send(cfg, c, e)
+}
+
+func (q *sendQueue) run(cfg floodConfig) {
+	for {
+		q.mu.Lock()
+		if len(q.pending) == 0 {
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+
+		if wait := q.take(cfg); wait > 0 {
+			q.mu.Unlock()
+			time.Sleep(wait)
+			continue
+		}
+
+		next := q.pending[0]
+		q.pending = q.pending[1:]
+		q.mu.Unlock()
+
+		q.out(next.c, next.e)
+		program.Send(sendQueueMsg{id: q.id, e: next.e})
+	}
+}
+
+// take tops up the bucket and spends a token,
+// or tells how long until there is one.
+func (q *sendQueue) take(cfg floodConfig) time.Duration {
+	now := time.Now()
+	if q.filled.IsZero() {
+		q.tokens = cfg.burst()
+	} else {
+		q.tokens = min(cfg.burst(), q.tokens+float64(now.Sub(q.filled))/float64(cfg.interval()))
+	}
+	q.filled = now
+
+	if q.tokens >= 1 {
+		q.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - q.tokens) * float64(cfg.interval()))
+}
+
+// out sends e, like girc lines keeping the connection alive don't count
+// as activity.
+func (q *sendQueue) out(c *girc.Client, e *girc.Event) {
+	c.Send(e)
+	switch e.Command {
+	case girc.PING, girc.PONG, girc.WHO:
+		return
+	}
+
+	q.mu.Lock()
+	q.active = time.Now()
+	q.mu.Unlock()
+}
+
+// idle tells how long ago the last line went out, zero if none did.
+func (q *sendQueue) idle() time.Duration {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.active.IsZero() {
+		return 0
+	}
+
+	return time.Since(q.active)
+}
+
+func (q *sendQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// cancel empties the queue and returns what was still waiting.
+func (q *sendQueue) cancel() []*girc.Event {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	events := make([]*girc.Event, len(q.pending))
+	for i, ln := range q.pending {
+		events[i] = ln.e
+	}
+	q.pending = nil
+	return events
+}
+
+// flood is the flood control of s, its own or the global one.
+func (m *model) flood(s *serverEntry) floodConfig {
+	if s.flood != nil {
+		return *s.flood
+	}
+
+	return m.cfg.Flood
+}
+
+// sendLine sends a line typed by the user through the flood control. sent
+// is true when it went out already, otherwise a sendQueueMsg tells when.
+func (m *model) sendLine(s *serverEntry, e *girc.Event) (sent bool) {
+	if m.sensitive {
+		e.Sensitive = true
+	}
+	if e.Sensitive {
+		s.taps.redact(e)
+	}
+	return s.queue.send(m.flood(s), s.client, e)
+}
+
+// sendRawLine parses a raw IRC line and queues it like /quote does.
+func (m *model) sendRawLine(s *serverEntry, line string) error {
+	e := girc.ParseEvent(line)
+	if e == nil {
+		return errors.New("invalid event: " + line)
+	}
+
+	m.sendLine(s, e)
+	return nil
+}
+
+// requeueMessages moves the messages a lost connection didn't send, or
+// sent without a confirmation, into the outbox. Other lines are dropped.
+func (m *model) requeueMessages(s *serverEntry) {
+	shown := map[*girc.Event]bool{}
+	for len(s.outLines) > 0 {
+		shown[s.outLines[0].e] = true
+		m.unconfirmed(s, s.outLines[0].e)
+	}
+
+	dropped := 0
+	for _, e := range s.queue.cancel() {
+		switch {
+		case shown[e]:
+		case e.Command != girc.PRIVMSG || len(e.Params) != 2 || e.Sensitive:
+			dropped++
+		default:
+			m.queueMessage(s, e.Params[0], e.Params[1])
+		}
+	}
+
+	if dropped > 0 {
+		m.pushSysLine(s.id, "_sys", "-- dropped "+plural(dropped, "queued line")+" --")
+	}
+}
+
+// queueCmd implements /queue [clear], it shows or cancels the lines
+// waiting for the flood control.
+func (m *model) queueCmd(s *serverEntry, arg string) []string {
+	switch strings.ToLower(strings.TrimSpace(arg)) {
+	case "":
+	case "clear", "cancel":
+		events := s.queue.cancel()
+		if len(events) == 0 {
+			return []string{"-- nothing queued --"}
+		}
+
+		m.cancelOutLines(s, events)
+		return []string{"-- cancelled " + plural(len(events), "queued line") + " --"}
+	default:
+		return []string{"usage: /queue [clear]"}
+	}
+
+	cfg := m.flood(s)
+	if cfg.Disabled {
+		return []string{"-- flood control is off --"}
+	}
+
+	q := s.queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	out := []string{fmt.Sprintf("-- %s queued, %g lines at once then one every %s --",
+		plural(len(q.pending), "line"), cfg.burst(), formatLag(cfg.interval()))}
+	for i, ln := range q.pending {
+		if i == queuePreview {
+			out = append(out, fmt.Sprintf("… %d more, /queue clear drops them", len(q.pending)-i))
+			break
+		}
+		if ln.e.Sensitive {
+			out = append(out, ln.e.Command+" ***redacted***")
+		} else {
+			out = append(out, strings.TrimSpace(ln.e.String()))
+		}
+	}
+
+	return out
+}
+
+// queueBadge is the number of waiting lines as shown next to a server,
+// empty when nothing waits.
+func queueBadge(q *sendQueue) string {
+	n := q.len()
+	if n == 0 {
+		return ""
+	}
+
+	return stylePinkB.Render(fmt.Sprintf("%d queued", n))
+}
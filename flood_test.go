@@ -0,0 +1,181 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lrstanley/girc"
+)
+
+func TestTake(t *testing.T) {
+	cfg := floodConfig{Burst: 3, IntervalMs: 1000}
+	tests := []struct {
+		name   string
+		tokens float64
+		idle   time.Duration // since the bucket was last topped up, 0 for a fresh bucket
+		want   time.Duration // wait before the next line
+		left   float64
+	}{
+		{name: "fresh bucket", want: 0, left: 2},
+		{name: "empty", tokens: 0, idle: time.Millisecond, want: 999 * time.Millisecond, left: 0.001},
+		{name: "half refilled", tokens: 0, idle: 500 * time.Millisecond, want: 500 * time.Millisecond, left: 0.5},
+		{name: "one refilled", tokens: 0, idle: time.Second, want: 0, left: 0},
+		{name: "idle refills to burst", tokens: 0, idle: time.Hour, want: 0, left: 2},
+		{name: "partial plus idle", tokens: 1.5, idle: 250 * time.Millisecond, want: 0, left: 0.75},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &sendQueue{tokens: tt.tokens}
+			if tt.idle > 0 {
+				q.filled = time.Now().Add(-tt.idle)
+			}
+
+			got := q.take(cfg)
+			// time passes between setting filled and take, allow for it
+			if d := got - tt.want; d > 0 || d < -50*time.Millisecond {
+				t.Errorf("wait %s, want %s", got, tt.want)
+			}
+			if d := q.tokens - tt.left; d < -0.001 || d > 0.05 {
+				t.Errorf("%g tokens left, want %g", q.tokens, tt.left)
+			}
+		})
+	}
+}
+
+func TestFloodPerServer(t *testing.T) {
+	m := newTestModel(t)
+	m.cfg.Flood = floodConfig{IntervalMs: 60_000}
+
+	own := newServerEntry(2, formCfg{Name: "own", Address: "127.0.0.1:6667", Nick: "me", Flood: &floodConfig{Disabled: true}})
+	if got := own.config().Flood; got == nil || !got.Disabled {
+		t.Fatalf("saved flood %+v", got)
+	}
+	m.servers[2] = own
+
+	for _, s := range m.servers {
+		s.client = girc.New(girc.Config{Server: "test", Nick: "me", User: "me"})
+		s.connected = true
+		s.queue.filled, s.queue.tokens = time.Now(), 0
+		defer s.queue.cancel()
+	}
+
+	if !m.sendLine(own, &girc.Event{Command: girc.PING, Params: []string{"x"}}) {
+		t.Error("own flood control off, line still queued")
+	}
+	if m.sendLine(m.servers[1], &girc.Event{Command: girc.PING, Params: []string{"x"}}) {
+		t.Error("global flood control skipped")
+	}
+
+	if got := m.queueCmd(own, ""); got[0] != "-- flood control is off --" {
+		t.Errorf("/queue on own: %q", got)
+	}
+	if got := m.queueCmd(m.servers[1], ""); !strings.Contains(got[0], "one every 60.0s") {
+		t.Errorf("/queue on fake: %q", got)
+	}
+}
+
+func TestCommandsUseFloodControl(t *testing.T) {
+	m := newTestModel(t, "#a")
+	m.activeID, m.activeChan = 1, "#a"
+	m.cfg.Flood = floodConfig{IntervalMs: 60_000}
+	s := m.servers[1]
+	s.connected = true
+	s.client = girc.New(girc.Config{Server: "test", Nick: "me_", User: "me"})
+	s.chanKeys = map[string]string{"#b": "sekrit"}
+	s.queue.filled, s.queue.tokens = time.Now(), 0
+	defer s.queue.cancel()
+
+	m.joinChannel(s, "#a")
+	m.joinChannel(s, "#b")
+	m.topicCmd(s, "#a", "new topic")
+	m.handleSlash(s, "/nick other")
+	m.handleSlash(s, "/regain")
+	next, _ := m.Update(sendLineMsg{id: 1, client: s.client, e: &girc.Event{Command: girc.NICK, Params: []string{"me_"}}})
+	m = next.(model)
+	m.Update(sendLineMsg{id: 1, client: girc.New(girc.Config{Server: "old"}), e: &girc.Event{Command: girc.NICK, Params: []string{"stale"}}})
+
+	want := []string{
+		"JOIN #a",
+		"JOIN #b sekrit",
+		"TOPIC #a :new topic",
+		"NICK other",
+		"PRIVMSG NickServ :REGAIN me",
+		"NICK me_",
+	}
+	s.queue.mu.Lock()
+	var got []string
+	for _, ln := range s.queue.pending {
+		got = append(got, strings.TrimSpace(ln.e.String()))
+		if ln.e.Sensitive != (ln.e.Command == girc.JOIN && len(ln.e.Params) > 1) {
+			t.Errorf("%q: sensitive %v", ln.e.String(), ln.e.Sensitive)
+		}
+	}
+	s.queue.mu.Unlock()
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("queued %q, want %q", got, want)
+	}
+}
+
+func TestQueriesUseFloodControl(t *testing.T) {
+	m := newTestModel(t, "#a")
+	m.cfg.Flood = floodConfig{IntervalMs: 60_000}
+	s := m.servers[1]
+	s.connected = true
+	s.client = girc.New(girc.Config{Server: "test", Nick: "me", User: "me"})
+	s.queue.filled, s.queue.tokens = time.Now(), 0
+	defer s.queue.cancel()
+
+	m.listCmd(chanListOpenMsg{id: 1, arg: "#go*"})
+	next, _ := m.Update(sendLineMsg{id: 1, client: s.client, e: &girc.Event{Command: girc.MODE, Params: []string{"me", "+ix"}}})
+	m = next.(model)
+
+	want := []string{"LIST", "MODE me +ix"}
+	var got []string
+	for _, e := range s.queue.cancel() {
+		got = append(got, strings.TrimSpace(e.String()))
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("queued %q, want %q", got, want)
+	}
+}
+
+func TestSendFirst(t *testing.T) {
+	cfg := floodConfig{Burst: 2, IntervalMs: 60_000}
+	c := girc.New(girc.Config{Server: "test", Nick: "me", User: "me"})
+	q := &sendQueue{}
+	defer q.cancel()
+
+	// a full bucket lets it out at once and pays for it
+	q.sendFirst(cfg, c, &girc.Event{Command: cmdBouncer, Params: []string{"BIND", "7"}})
+	if q.len() != 0 || q.tokens != 1 {
+		t.Fatalf("%d queued, %g tokens left", q.len(), q.tokens)
+	}
+
+	// it doesn't jump lines already waiting
+	q.mu.Lock()
+	q.tokens = 0
+	q.pending = append(q.pending, queuedLine{c: c, e: &girc.Event{Command: girc.PING, Params: []string{"x"}}})
+	q.running = true // the line waits for a token
+	q.mu.Unlock()
+	q.sendFirst(cfg, c, &girc.Event{Command: cmdBouncer, Params: []string{"BIND", "8"}})
+	if q.len() != 2 {
+		t.Errorf("%d queued, want 2", q.len())
+	}
+}
+
+func TestQueueIdle(t *testing.T) {
+	c := girc.New(girc.Config{Server: "test", Nick: "me", User: "me"})
+	q := &sendQueue{}
+	if q.idle() != 0 {
+		t.Errorf("idle %s before sending anything", q.idle())
+	}
+
+	q.send(floodConfig{Disabled: true}, c, &girc.Event{Command: girc.PRIVMSG, Params: []string{"#a", "hi"}})
+	q.active = q.active.Add(-time.Minute)
+	q.send(floodConfig{Disabled: true}, c, &girc.Event{Command: girc.PING, Params: []string{"x"}})
+	if d := q.idle(); d < time.Minute || d > time.Minute+time.Second {
+		t.Errorf("idle %s, a PING counts as activity", d)
+	}
+}
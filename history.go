@@ -0,0 +1,280 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lrstanley/girc"
+)
+
+const (
+	capChatHistory        = "draft/chathistory"
+	cmdBatch              = "BATCH"
+	cmdChatHistory        = "CHATHISTORY"
+	historyPageSize       = 50
+	chathistoryTimeLayout = "2006-01-02T15:04:05.000Z"
+)
+
+// historyBatchMsg carries one finished chathistory batch.
+type historyBatchMsg struct {
+	id      serverID
+	channel string
+	lines   []ircChanLineMsg
+	events  int       // everything the server sent in the batch
+	oldest  time.Time // of those events
+}
+
+// historyTracker collects lines of open chathistory batches,
+// they are applied in one go once the batch ends.
+// It also remembers the type of every open batch.
+type historyTracker struct {
+	mu      sync.Mutex
+	batches map[string]*historyBatchMsg // batch ref => lines
+	types   map[string]string           // batch ref => type
+}
+
+func newHistoryTracker() *historyTracker {
+	return &historyTracker{batches: map[string]*historyBatchMsg{}, types: map[string]string{}}
+}
+
+// handleBatch tracks BATCH +ref chathistory <target> / BATCH -ref.
+func (h *historyTracker) handleBatch(id serverID, e girc.Event) {
+	if len(e.Params) == 0 || len(e.Params[0]) < 2 {
+		return
+	}
+
+	ref := e.Params[0][1:]
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch e.Params[0][0] {
+	case '+':
+		if len(e.Params) >= 2 {
+			h.types[ref] = e.Params[1]
+		}
+
+		if len(e.Params) >= 3 && e.Params[1] == "chathistory" {
+			h.batches[ref] = &historyBatchMsg{id: id, channel: e.Params[2]}
+		}
+	case '-':
+		delete(h.types, ref)
+		if b, ok := h.batches[ref]; ok {
+			delete(h.batches, ref)
+			program.Send(*b)
+		}
+	}
+}
+
+// hold keeps a line back if its event belongs to a chathistory batch.
+func (h *historyTracker) hold(e girc.Event, msg ircChanLineMsg) bool {
+	ref, ok := e.Tags.Get("batch")
+	if !ok {
+		return false
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	b, ok := h.batches[ref]
+	if !ok {
+		return false
+	}
+
+	b.lines = append(b.lines, msg)
+	return true
+}
+
+// count notes every event of a chathistory batch, shown or not,
+// the server's answer tells when the history ends.
+func (h *historyTracker) count(e girc.Event) {
+	ref, ok := e.Tags.Get("batch")
+	if !ok {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if b, ok := h.batches[ref]; ok {
+		b.events++
+		if b.oldest.IsZero() || e.Timestamp.Before(b.oldest) {
+			b.oldest = e.Timestamp
+		}
+	}
+}
+
+// batchType returns the type of the open batch an event belongs to.
+func (h *historyTracker) batchType(e girc.Event) string {
+	ref, ok := e.Tags.Get("batch")
+	if !ok {
+		return ""
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.types[ref]
+}
+
+// requestLatestHistory asks for the newest page right after our own JOIN.
+func requestLatestHistory(c *girc.Client, id serverID, channel string) {
+	if !c.HasCapability(capChatHistory) {
+		return
+	}
+
+	sendFromHandler(c, id, &girc.Event{Command: cmdChatHistory, Params: []string{"LATEST", channel, "*", strconv.Itoa(historyLimit(c))}})
+}
+
+// requestOlderHistory fetches the page before the oldest line of the
+// active buffer, at most one request per buffer is in flight.
+func (m *model) requestOlderHistory() {
+	s := m.servers[m.activeID]
+	ch := m.activeChan
+	if s == nil || !s.support.isChannel(ch) || s.client == nil || !s.connected {
+		return
+	}
+
+	if !s.client.HasCapability(capChatHistory) || s.historyPending[ch] || s.historyEnd[ch] {
+		return
+	}
+
+	logs := s.channelLogs[ch]
+	if len(logs) == 0 {
+		return
+	}
+
+	// pages of ignored lines add nothing, the cursor still moves past them
+	oldest := logs[0].at
+	if before, ok := s.historyOldest[ch]; ok && before.Before(oldest) {
+		oldest = before
+	}
+
+	m.sendLine(s, &girc.Event{Command: cmdChatHistory, Params: []string{"BEFORE", ch, "timestamp=" + oldest.UTC().Format(chathistoryTimeLayout), strconv.Itoa(historyLimit(s.client))}})
+	s.historyPending[ch] = true
+}
+
+// historyLimit honours the CHATHISTORY=<n> ISUPPORT token.
+func historyLimit(c *girc.Client) int {
+	if n, ok := c.GetServerOptionInt("CHATHISTORY"); ok && n > 0 && n < historyPageSize {
+		return n
+	}
+
+	return historyPageSize
+}
+
+// applyHistory merges a batch into the buffer by time,
+// lines whose msgid is already stored are dropped. A batch shorter than
+// the page size is the start of the history.
+func (m *model) applyHistory(msg historyBatchMsg) {
+	s, ok := m.servers[msg.id]
+	if !ok {
+		return
+	}
+
+	ch := s.buffer(msg.channel)
+	s.historyPending[ch] = false
+	limit := historyPageSize
+	if s.client != nil {
+		limit = historyLimit(s.client)
+	}
+	if msg.events < limit {
+		s.historyEnd[ch] = true
+	}
+	if before, ok := s.historyOldest[ch]; !msg.oldest.IsZero() && (!ok || msg.oldest.Before(before)) {
+		s.historyOldest[ch] = msg.oldest
+	}
+
+	added := 0
+	for _, l := range msg.lines {
+		if s.buffer(l.channel) != ch {
+			continue
+		}
+
+		line := chatLine{at: l.at, text: l.line, tags: l.tags}
+		if m.ignored(s, l.source, l.class) || s.seenMsgID(ch, line) {
+			continue
+		}
+
+		s.channelLogs[ch] = append(s.channelLogs[ch], line)
+		added++
+	}
+
+	if added == 0 {
+		return
+	}
+
+	sort.SliceStable(s.channelLogs[ch], func(i, j int) bool {
+		return s.channelLogs[ch][i].at.Before(s.channelLogs[ch][j].at)
+	})
+
+	if m.mode == modeChat && m.activeID == msg.id && m.activeChan == ch {
+		m.refreshChatKeepOffset()
+	}
+}
+
+// resetHistory forgets what was fetched, a new connection may
+// have more history to offer.
+func (s *serverEntry) resetHistory() {
+	s.historyPending = make(map[string]bool)
+	s.historyEnd = make(map[string]bool)
+	s.historyOldest = make(map[string]time.Time)
+}
+
+// seenMsgID records the msgid of a line and reports whether
+// the buffer already had it.
+func (s *serverEntry) seenMsgID(ch string, l chatLine) bool {
+	id, ok := l.tags.Get("msgid")
+	if !ok || id == "" {
+		return false
+	}
+
+	k := ch + "\x00" + id
+	if s.msgids[k] {
+		return true
+	}
+
+	s.msgids[k] = true
+	return false
+}
+
+// refreshChatKeepOffset re-renders the buffer without jumping: the line
+// at the top of the view stays there whether rows were added above or
+// below it.
+func (m *model) refreshChatKeepOffset() {
+	atBottom := m.chatVP.AtBottom()
+	before, off := m.chatVP.TotalLineCount(), m.chatVP.YOffset
+	top, within, ok := m.topChatLine(off)
+	m.refreshChat()
+	if atBottom || m.currentMatch() >= 0 {
+		return
+	}
+
+	if ok {
+		for i, ln := range m.activeLogs() {
+			if ln.at.Equal(top.at) && ln.text == top.text && i < len(m.chatRows) {
+				m.chatVP.SetYOffset(m.chatRows[i] + within)
+				return
+			}
+		}
+	}
+
+	m.chatVP.SetYOffset(off + m.chatVP.TotalLineCount() - before)
+}
+
+// topChatLine is the log line shown at viewport row off, and how many of
+// its wrapped rows are above that.
+func (m *model) topChatLine(off int) (chatLine, int, bool) {
+	logs := m.chatShown
+	i := sort.Search(len(m.chatRows), func(i int) bool { return m.chatRows[i] > off }) - 1
+	if i < 0 || i >= len(logs) {
+		return chatLine{}, 0, false
+	}
+
+	return logs[i], off - m.chatRows[i], true
+}
+
+func (m *model) activeLogs() []chatLine {
+	if s := m.servers[m.activeID]; s != nil {
+		return s.channelLogs[m.activeChan]
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lrstanley/girc"
+)
+
+func historyBatch(ch string, from time.Time, n int, msgid func(i int) string) historyBatchMsg {
+	b := historyBatchMsg{id: 1, channel: ch, events: n, oldest: from}
+	for i := range n {
+		tags := girc.Tags{}
+		tags.Set("msgid", msgid(i))
+		b.lines = append(b.lines, ircChanLineMsg{id: 1, channel: ch, line: fmt.Sprint("line ", i), at: from.Add(time.Duration(i) * time.Second), tags: tags})
+	}
+
+	return b
+}
+
+func TestApplyHistoryEnd(t *testing.T) {
+	start := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		batches []historyBatchMsg
+		end     bool
+		lines   int
+	}{
+		{"empty batch", []historyBatchMsg{{id: 1, channel: "#go"}}, true, 0},
+		{"short page", []historyBatchMsg{historyBatch("#go", start, 3, func(i int) string { return fmt.Sprint("a", i) })}, true, 3},
+		{"full page", []historyBatchMsg{historyBatch("#go", start, historyPageSize, func(i int) string { return fmt.Sprint("a", i) })}, false, historyPageSize},
+		{"full page of duplicates", []historyBatchMsg{
+			historyBatch("#go", start, historyPageSize, func(i int) string { return fmt.Sprint("a", i) }),
+			historyBatch("#go", start, historyPageSize, func(i int) string { return fmt.Sprint("a", i) }),
+		}, false, historyPageSize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestModel(t, "#go")
+			s := m.servers[1]
+			s.channelLogs["#go"] = nil
+			for _, b := range tt.batches {
+				m.applyHistory(b)
+			}
+
+			if s.historyEnd["#go"] != tt.end {
+				t.Errorf("historyEnd = %v, want %v", s.historyEnd["#go"], tt.end)
+			}
+			if n := len(s.channelLogs["#go"]); n != tt.lines {
+				t.Errorf("%d lines, want %d", n, tt.lines)
+			}
+		})
+	}
+}
+
+func TestHistoryResetOnConnect(t *testing.T) {
+	m := newTestModel(t, "#go")
+	s := m.servers[1]
+	s.historyEnd["#go"] = true
+	s.historyOldest["#go"] = time.Now()
+
+	next, _ := m.Update(connectedMsg(1))
+	s = next.(model).servers[1]
+	if s.historyEnd["#go"] || len(s.historyOldest) != 0 {
+		t.Errorf("history state survived a reconnect: %v %v", s.historyEnd, s.historyOldest)
+	}
+}
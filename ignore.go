@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lrstanley/girc"
+)
+
+// line classes an ignore rule can filter
+const (
+	classMsgs    = "msgs"
+	classNotices = "notices"
+	classCTCP    = "ctcp"
+	classJoins   = "joins" // joins, parts and quits
+	classInvites = "invites"
+)
+
+var ignoreClasses = []string{classMsgs, classNotices, classCTCP, classJoins, classInvites}
+
+type ignoreRule struct {
+	Mask    string     `json:"mask"`            // nick!user@host, * and ? wildcards
+	Types   []string   `json:"types,omitempty"` // empty means everything
+	Expires *time.Time `json:"expires,omitempty"`
+
+	re *regexp.Regexp
+}
+
+func (r *ignoreRule) matches(source, class string, now time.Time) bool {
+	if r.Expires != nil && now.After(*r.Expires) {
+		return false
+	}
+
+	if len(r.Types) > 0 && !contains(r.Types, class) {
+		return false
+	}
+
+	if r.re == nil {
+		r.re = maskRegexp(r.Mask)
+	}
+
+	return r.re.MatchString(source)
+}
+
+func (r ignoreRule) String() string {
+	types := "all"
+	if len(r.Types) > 0 {
+		types = strings.Join(r.Types, ",")
+	}
+
+	s := r.Mask + " [" + types + "]"
+	if r.Expires != nil {
+		s += " until " + r.Expires.Local().Format("Jan 02 15:04")
+	}
+
+	return s
+}
+
+// normalizeMask turns "nick" or "nick!user" into a full nick!user@host mask.
+func normalizeMask(mask string) string {
+	if !strings.Contains(mask, "!") {
+		if strings.Contains(mask, "@") {
+			mask = "*!" + mask
+		} else {
+			mask += "!*"
+		}
+	}
+
+	if !strings.Contains(mask, "@") {
+		mask += "@*"
+	}
+
+	return mask
+}
+
+func maskRegexp(mask string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("(?i)^")
+	for _, r := range mask {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// parseIgnoreArgs reads "/ignore <mask> [types] [duration]".
+func parseIgnoreArgs(args []string) (ignoreRule, error) {
+	r := ignoreRule{Mask: normalizeMask(args[0])}
+	for _, a := range args[1:] {
+		if d, err := parseExpiry(a); err == nil {
+			t := time.Now().Add(d)
+			r.Expires = &t
+			continue
+		}
+
+		for _, t := range strings.Split(strings.ToLower(a), ",") {
+			switch {
+			case t == "" || t == "all":
+			case contains(ignoreClasses, t):
+				if !contains(r.Types, t) {
+					r.Types = append(r.Types, t)
+				}
+			default:
+				return r, fmt.Errorf("unknown type %q, want %s or a duration", t, strings.Join(ignoreClasses, ", "))
+			}
+		}
+	}
+
+	return r, nil
+}
+
+// parseExpiry accepts Go durations plus a day suffix ("2d").
+func parseExpiry(s string) (time.Duration, error) {
+	if n, ok := strings.CutSuffix(s, "d"); ok {
+		days, err := strconv.Atoi(n)
+		if err != nil || days <= 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err == nil && d <= 0 {
+		err = fmt.Errorf("invalid duration %q", s)
+	}
+
+	return d, err
+}
+
+// ignored reports whether a line from source is silenced on the network.
+func (m *model) ignored(s *serverEntry, source, class string) bool {
+	if source == "" {
+		return false
+	}
+
+	now := time.Now()
+	for i := range m.cfg.Ignores[s.name] {
+		if m.cfg.Ignores[s.name][i].matches(source, class, now) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ignoreCmd implements /ignore and /unignore, returning the lines to show.
+func (m *model) ignoreCmd(s *serverEntry, unignore bool, arg string) []string {
+	now := time.Now()
+	var rules []ignoreRule
+	for _, r := range m.cfg.Ignores[s.name] {
+		if r.Expires == nil || now.Before(*r.Expires) {
+			rules = append(rules, r)
+		}
+	}
+
+	args := strings.Fields(arg)
+	switch {
+	case len(args) == 0 && unignore:
+		return []string{"usage: /unignore <mask|number>"}
+	case len(args) == 0:
+		if len(rules) == 0 {
+			return []string{"-- no ignores on " + s.name + " --"}
+		}
+
+		out := []string{"-- ignores on " + s.name + " --"}
+		for i, r := range rules {
+			out = append(out, fmt.Sprintf("%d. %s", i+1, r))
+		}
+		return out
+	case unignore:
+		idx := -1
+		if n, err := strconv.Atoi(args[0]); err == nil && n >= 1 && n <= len(rules) {
+			idx = n - 1
+		} else {
+			mask := normalizeMask(args[0])
+			for i, r := range rules {
+				if strings.EqualFold(r.Mask, mask) {
+					idx = i
+					break
+				}
+			}
+		}
+
+		if idx < 0 {
+			return []string{"no ignore matches " + args[0]}
+		}
+
+		removed := rules[idx]
+		rules = append(rules[:idx], rules[idx+1:]...)
+		return append([]string{"-- unignored " + removed.Mask + " --"}, m.storeIgnores(s, rules)...)
+	}
+
+	r, err := parseIgnoreArgs(args)
+	if err != nil {
+		return []string{"ignore: " + err.Error()}
+	}
+
+	replaced := false
+	for i := range rules {
+		if strings.EqualFold(rules[i].Mask, r.Mask) {
+			rules[i], replaced = r, true
+		}
+	}
+
+	if !replaced {
+		rules = append(rules, r)
+	}
+
+	return append([]string{"-- ignoring " + r.String() + " --"}, m.storeIgnores(s, rules)...)
+}
+
+func (m *model) storeIgnores(s *serverEntry, rules []ignoreRule) []string {
+	if m.cfg.Ignores == nil {
+		m.cfg.Ignores = map[string][]ignoreRule{}
+	}
+
+	m.cfg.Ignores[s.name] = rules
+	if len(rules) == 0 {
+		delete(m.cfg.Ignores, s.name)
+	}
+	s.ignores.set(rules)
+
+	if err := saveConfig(*m.cfg); err != nil {
+		return []string{"ignore list not saved: " + err.Error()}
+	}
+
+	return nil
+}
+
+// ignoreList is a copy of a server's rules for girc's goroutines,
+// which must not read the config while Update changes it.
+type ignoreList struct {
+	mu    sync.Mutex
+	rules []ignoreRule
+}
+
+func (l *ignoreList) set(rules []ignoreRule) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rules = append([]ignoreRule(nil), rules...)
+}
+
+func (l *ignoreList) matches(source, class string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	for i := range l.rules {
+		if l.rules[i].matches(source, class, now) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// guardCTCP answers the CTCP queries girc answers by default, but stays
+// quiet for ignored masks. girc keeps its handlers to itself, each one is
+// set again with the same reply behind the ignore check. idle tells how
+// long ago we last sent something, for FINGER.
+func guardCTCP(c *girc.Client, ignores *ignoreList, idle func() time.Duration) {
+	replies := map[string]func(*girc.Client, girc.CTCPEvent) string{
+		girc.CTCP_PING: func(_ *girc.Client, e girc.CTCPEvent) string { return e.Text },
+		girc.CTCP_PONG: func(*girc.Client, girc.CTCPEvent) string { return "" },
+		girc.CTCP_VERSION: func(cl *girc.Client, _ girc.CTCPEvent) string {
+			if cl.Config.Version != "" {
+				return cl.Config.Version
+			}
+			return fmt.Sprintf("clirc using %s (%s, %s)", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+		},
+		girc.CTCP_TIME:   func(*girc.Client, girc.CTCPEvent) string { return ":" + time.Now().Format(time.RFC1123Z) },
+		girc.CTCP_SOURCE: func(*girc.Client, girc.CTCPEvent) string { return "https://github.com/pchchv/clirc" },
+		girc.CTCP_FINGER: func(cl *girc.Client, _ girc.CTCPEvent) string {
+			return fmt.Sprintf("%s -- idle %s", cl.Config.Name, idle().Round(time.Second))
+		},
+	}
+
+	for cmd, reply := range replies {
+		c.CTCP.SetBg(cmd, func(cl *girc.Client, e girc.CTCPEvent) {
+			if e.Reply || e.Source == nil || ignores.matches(e.Source.String(), classCTCP) {
+				return
+			}
+			cl.Cmd.SendCTCPReply(e.Source.ID(), cmd, reply(cl, e))
+		})
+	}
+}
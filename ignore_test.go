@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lrstanley/girc"
+)
+
+func TestGuardCTCP(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	c := girc.New(girc.Config{Server: "test", Nick: "me", User: "me", Name: "Me", PingDelay: -1})
+	ignores := &ignoreList{}
+	ignores.set([]ignoreRule{{Mask: "spam!*@*", Types: []string{classCTCP}}})
+	guardCTCP(c, ignores, func() time.Duration { return 90 * time.Second })
+	go c.MockConnect(client)
+	defer c.Close()
+
+	replies := make(chan string, 16)
+	go func() {
+		sc := bufio.NewScanner(server)
+		for sc.Scan() {
+			if strings.HasPrefix(sc.Text(), "NOTICE") {
+				replies <- sc.Text()
+			}
+		}
+	}()
+
+	for _, ln := range []string{
+		":srv 001 me :Welcome",
+		":spam!u@h PRIVMSG me :\x01VERSION\x01",
+		":spam!u@h PRIVMSG me :\x01PING 1\x01",
+		":spam!u@h PRIVMSG me :\x01FINGER\x01",
+		":friend!u@h PRIVMSG me :\x01PING 2\x01",
+		":friend!u@h PRIVMSG me :\x01FINGER\x01",
+		":friend!u@h PRIVMSG me :\x01PONG\x01",
+	} {
+		if _, err := server.Write([]byte(ln + "\r\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// girc's defaults all still answer, in no particular order
+	want := map[string]bool{
+		"NOTICE friend :\x01PING 2\x01":                  true,
+		"NOTICE friend :\x01FINGER Me -- idle 1m30s\x01": true,
+		"NOTICE friend \x01PONG\x01":                     true,
+	}
+	for len(want) > 0 {
+		select {
+		case got := <-replies:
+			if !want[got] {
+				t.Errorf("reply %q", got)
+			}
+			delete(want, got)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no reply to friend, missing %v", want)
+		}
+	}
+
+	select {
+	case got := <-replies:
+		t.Errorf("unexpected reply %q", got)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestMaskRegexp(t *testing.T) {
+	tests := []struct {
+		mask, source string
+		want         bool
+	}{
+		{"spam!*@*", "spam!u@host", true},
+		{"spam!*@*", "SPAM!u@host", true},
+		{"spam!*@*", "spammer!u@host", false},
+		{"*!*@*.example", "a!b@c.example", true},
+		{"*!*@*.example", "a!b@example", false},
+		{"b?b!*@*", "bob!u@h", true},
+		{"b?b!*@*", "bb!u@h", false},
+		{"[x]!*@*", "[x]!u@h", true}, // regexp characters are literal
+		{"[x]!*@*", "x!u@h", false},
+		{"a.b!*@*", "axb!u@h", false},
+		{"*", "", true},
+	}
+
+	for _, tt := range tests {
+		if got := maskRegexp(tt.mask).MatchString(tt.source); got != tt.want {
+			t.Errorf("%q on %q: got %v", tt.mask, tt.source, got)
+		}
+	}
+}
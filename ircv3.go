@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lrstanley/girc"
+)
+
+// girc requests server-time and message-tags on its own,
+// echo-message is opt-in.
+const capEchoMessage = "echo-message"
+
+func supportedCaps() map[string][]string {
+	return map[string][]string{
+		capEchoMessage:     nil,
+		capChatHistory:     nil,
+		capBouncerNetworks: nil,
+		capBouncerNotify:   nil,
+	}
+}
+
+// stamp formats a line timestamp, event times are
+// already synced to server-time when the server supports it.
+// Lines from another day carry the date too.
+func stamp(t time.Time) string {
+	t = t.Local()
+	if now := time.Now(); t.YearDay() != now.YearDay() || t.Year() != now.Year() {
+		return t.Format("Jan 02 15:04")
+	}
+
+	return t.Format("15:04")
+}
+
+// echoConfirmed reports whether our own messages come back
+// from the server instead of being echoed locally.
+func echoConfirmed(c *girc.Client) bool {
+	return c != nil && c.HasCapability(capEchoMessage)
+}
+
+// handleEcho renders our own PRIVMSG/NOTICE once the server echoes it,
+// girc only passes echo-message events to ALL_EVENTS handlers.
+func handleEcho(id serverID, support *isupport, hist *historyTracker, e girc.Event) {
+	if msg, ok := echoLine(id, support, e); ok && !hist.hold(e, msg) {
+		program.Send(msg)
+	}
+}
+
+// echoLine renders an echoed line of ours, stamped with the server's time.
+func echoLine(id serverID, support *isupport, e girc.Event) (ircChanLineMsg, bool) {
+	if !e.Echo || len(e.Params) < 2 {
+		return ircChanLineMsg{}, false
+	}
+
+	ch, status := support.route(e.Params[0])
+	text := statusText(status, e.Last())
+	var line string
+	switch {
+	case e.IsAction():
+		line = styleDim.Render(fmt.Sprintf("[%s] * %s %s", stamp(e.Timestamp), e.Source.Name, statusText(status, e.StripAction())))
+	case e.Command == girc.NOTICE:
+		line = styleDim.Render(fmt.Sprintf("[%s] -NOTICE to %s- %s", stamp(e.Timestamp), e.Params[0], text))
+	case ch == "_sys":
+		line = styleDarkPink.Render(fmt.Sprintf("[%s] [to %s] %s", stamp(e.Timestamp), e.Params[0], text))
+	default:
+		line = styleDarkPink.Render(fmt.Sprintf("[%s] <%s> %s", stamp(e.Timestamp), e.Source.Name, text))
+	}
+
+	return ircChanLineMsg{id: id, channel: ch, line: line, at: e.Timestamp, tags: e.Tags}, true
+}
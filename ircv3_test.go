@@ -0,0 +1,111 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/x/ansi"
+	"github.com/lrstanley/girc"
+)
+
+func TestStamp(t *testing.T) {
+	now := time.Now()
+	old := time.Date(2025, 1, 2, 10, 4, 0, 0, time.UTC)
+	tests := []struct {
+		at   time.Time
+		want string
+	}{
+		{at: now, want: now.Format("15:04")},
+		{at: now.UTC(), want: now.Format("15:04")}, // server-time is UTC
+		{at: now.AddDate(0, 0, -1), want: now.AddDate(0, 0, -1).Format("Jan 02 15:04")},
+		{at: now.AddDate(-1, 0, 0), want: now.AddDate(-1, 0, 0).Format("Jan 02 15:04")},
+		{at: old, want: old.Local().Format("Jan 02 15:04")},
+	}
+
+	for _, tt := range tests {
+		if got := stamp(tt.at); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.at, got, tt.want)
+		}
+	}
+}
+
+// echoed parses a line as girc hands our own echoed lines over.
+func echoed(raw string) girc.Event {
+	e := girc.ParseEvent(raw)
+	e.Echo = true
+	return *e
+}
+
+func TestEchoLine(t *testing.T) {
+	support := newISupport()
+	support.parse([]string{"STATUSMSG=@+"})
+	at := time.Date(2025, 1, 2, 10, 4, 0, 0, time.UTC)
+	ts := stamp(at)
+	const tags = "@time=2025-01-02T10:04:00.000Z;msgid=m1 "
+	tests := []struct {
+		name string
+		raw  string
+		ch   string
+		want string
+	}{
+		{name: "channel", raw: tags + ":me!u@h PRIVMSG #a :hi there", ch: "#a", want: "[" + ts + "] <me> hi there"},
+		{name: "action", raw: tags + ":me!u@h PRIVMSG #a :\x01ACTION waves\x01", ch: "#a", want: "[" + ts + "] * me waves"},
+		{name: "notice", raw: tags + ":me!u@h NOTICE #a :heads up", ch: "#a", want: "[" + ts + "] -NOTICE to #a- heads up"},
+		{name: "private", raw: tags + ":me!u@h PRIVMSG bob :psst", ch: "_sys", want: "[" + ts + "] [to bob] psst"},
+		{name: "ops only", raw: tags + ":me!u@h PRIVMSG @#a :ops", ch: "#a", want: "[" + ts + "] <me> [@] ops"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, ok := echoLine(1, support, echoed(tt.raw))
+			if !ok {
+				t.Fatal("not shown")
+			}
+			if msg.channel != tt.ch || ansi.Strip(msg.line) != tt.want {
+				t.Errorf("got %s %q, want %s %q", msg.channel, ansi.Strip(msg.line), tt.ch, tt.want)
+			}
+			if !msg.at.Equal(at) {
+				t.Errorf("at %s, want the server's %s", msg.at, at)
+			}
+			if id, _ := msg.tags.Get("msgid"); id != "m1" {
+				t.Errorf("msgid %q", id)
+			}
+		})
+	}
+
+	// only echoes of our own lines
+	if _, ok := echoLine(1, support, *girc.ParseEvent(tags + ":bob!u@h PRIVMSG #a :hi")); ok {
+		t.Error("someone else's line taken for an echo")
+	}
+	if _, ok := echoLine(1, support, echoed(tags+":me!u@h PRIVMSG #a")); ok {
+		t.Error("line without text shown")
+	}
+}
+
+func TestEchoDedup(t *testing.T) {
+	m := newTestModel(t, "#a")
+	s := m.servers[1]
+	e := echoed("@time=2025-01-02T10:04:00.000Z;msgid=m1 :me!u@h PRIVMSG #a :hi")
+
+	// the echo and the same line again from a history page
+	msg, _ := echoLine(1, s.support, e)
+	m.applyChanLine(msg)
+	m.applyChanLine(msg)
+	if got := len(s.channelLogs["#a"]); got != 1 {
+		t.Errorf("%d lines for one msgid", got)
+	}
+
+	// the stand-in of a queued message goes once it is sent, the echo replaces it
+	out := &girc.Event{Command: girc.PRIVMSG, Params: []string{"#a", "later"}}
+	o := &outLine{e: out, target: "#a", ch: "#a", text: "<me> later", echo: true}
+	s.outLines = append(s.outLines, o)
+	s.channelLogs["#a"] = append(s.channelLogs["#a"], chatLine{at: time.Now(), text: o.render(), out: o})
+	m.lineSent(s, out)
+	if len(s.outLines) != 0 || len(s.channelLogs["#a"]) != 1 {
+		t.Errorf("%d out lines, %d lines left", len(s.outLines), len(s.channelLogs["#a"]))
+	}
+	if got := ansi.Strip(s.channelLogs["#a"][0].text); !strings.HasSuffix(got, "<me> hi") {
+		t.Errorf("left %q", got)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// casemappings understood by fold, anything else folds ASCII only
+const (
+	caseRFC1459       = "rfc1459"
+	caseRFC1459Strict = "rfc1459-strict"
+)
+
+// isupport holds the RPL_ISUPPORT tokens that change how targets and
+// names are read. It is filled from the connection goroutine.
+type isupport struct {
+	mu          sync.RWMutex
+	chanTypes   string
+	prefixModes string // "ov", in the same order as prefixChars
+	prefixChars string // "@+"
+	caseMapping string
+	chanModes   [4]string // list, always a parameter, parameter when set, never
+	nickLen     int       // 0 when not announced
+	topicLen    int
+	statusMsg   string // prefixes of "@#chan" style targets
+	eList       string // LIST filters the server understands
+}
+
+func newISupport() *isupport {
+	i := &isupport{}
+	i.reset()
+	return i
+}
+
+// reset goes back to what a server announcing nothing implies.
+func (i *isupport) reset() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.chanTypes = "#&"
+	i.prefixModes, i.prefixChars = "ov", "@+"
+	i.caseMapping = caseRFC1459
+	i.chanModes = [4]string{"beI", "k", "l", "imnpst"}
+	i.nickLen, i.topicLen = 0, 0
+	i.statusMsg, i.eList = "", ""
+}
+
+// parse reads the tokens of one RPL_ISUPPORT line, "-TOKEN" restores the default.
+func (i *isupport) parse(tokens []string) {
+	def := newISupport()
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for _, tok := range tokens {
+		name, value, _ := strings.Cut(tok, "=")
+		negate := strings.HasPrefix(name, "-")
+		if negate {
+			name = name[1:]
+		}
+
+		switch strings.ToUpper(name) {
+		case "CHANTYPES":
+			i.chanTypes = value
+			if negate {
+				i.chanTypes = def.chanTypes
+			}
+		case "PREFIX":
+			i.prefixModes, i.prefixChars = def.prefixModes, def.prefixChars
+			modes, chars, ok := strings.Cut(strings.TrimPrefix(value, "("), ")")
+			if !negate && ok && len(modes) == len(chars) {
+				i.prefixModes, i.prefixChars = modes, chars
+			} else if !negate && value == "" {
+				i.prefixModes, i.prefixChars = "", ""
+			}
+		case "CASEMAPPING":
+			i.caseMapping = strings.ToLower(value)
+			if negate || value == "" {
+				i.caseMapping = def.caseMapping
+			}
+		case "CHANMODES":
+			i.chanModes = def.chanModes
+			if !negate {
+				copy(i.chanModes[:], strings.SplitN(value, ",", 4))
+			}
+		case "NICKLEN", "MAXNICKLEN":
+			i.nickLen, _ = strconv.Atoi(value)
+		case "TOPICLEN":
+			i.topicLen, _ = strconv.Atoi(value)
+		case "STATUSMSG":
+			i.statusMsg = value
+			if negate {
+				i.statusMsg = ""
+			}
+		case "ELIST":
+			i.eList = strings.ToUpper(value)
+			if negate {
+				i.eList = ""
+			}
+		}
+	}
+}
+
+func (i *isupport) isChannel(name string) bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return name != "" && strings.IndexByte(i.chanTypes, name[0]) >= 0
+}
+
+// route returns the buffer of a message target, channels get their own,
+// everything else goes to "_sys". status is the STATUSMSG prefix of a
+// target like "@#chan", meant for the channel operators only.
+func (i *isupport) route(target string) (buffer, status string) {
+	i.mu.RLock()
+	trimmed := strings.TrimLeft(target, i.statusMsg)
+	i.mu.RUnlock()
+
+	if trimmed != target && i.isChannel(trimmed) {
+		return trimmed, target[:len(target)-len(trimmed)]
+	}
+
+	if i.isChannel(target) {
+		return target, ""
+	}
+
+	return "_sys", ""
+}
+
+// trimPrefix removes the membership prefixes of a NAMES entry.
+func (i *isupport) trimPrefix(name string) string {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return strings.TrimLeft(name, i.prefixChars)
+}
+
+// fold lowercases a nick or channel by the server's CASEMAPPING.
+func (i *isupport) fold(name string) string {
+	i.mu.RLock()
+	mapping := i.caseMapping
+	i.mu.RUnlock()
+
+	upper := byte('Z')
+	switch mapping {
+	case caseRFC1459:
+		upper = '^' // [\]^ fold to {|}~
+	case caseRFC1459Strict:
+		upper = ']'
+	}
+
+	b := []byte(name)
+	for n, c := range b {
+		if c >= 'A' && c <= upper {
+			b[n] = c + 32
+		}
+	}
+
+	return string(b)
+}
+
+func (i *isupport) equal(a, b string) bool {
+	return i.fold(a) == i.fold(b)
+}
+
+// validNick checks a nick against NICKLEN.
+func (i *isupport) validNick(nick string) bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.nickLen == 0 || len(nick) <= i.nickLen
+}
+
+func (i *isupport) nickLenHint() string {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if i.nickLen == 0 {
+		return ""
+	}
+
+	return " (at most " + strconv.Itoa(i.nickLen) + " characters)"
+}
+
+// maxTopic is TOPICLEN, 0 when not announced.
+func (i *isupport) maxTopic() int {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.topicLen
+}
+
+// hasEList reports whether LIST filters by c, M for masks and U for user counts.
+func (i *isupport) hasEList(c byte) bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return strings.IndexByte(i.eList, c) >= 0
+}
+
+func (i *isupport) channelTypes() string {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.chanTypes
+}
+
+// buffer returns the name of the buffer ch belongs to, channels differing
+// only in case share the first buffer seen.
+func (s *serverEntry) buffer(ch string) string {
+	if ch == "" || ch == "_sys" {
+		return ch
+	}
+
+	for _, c := range s.channels {
+		if s.support.equal(c, ch) {
+			return c
+		}
+	}
+
+	for c := range s.channelLogs {
+		if s.support.equal(c, ch) {
+			return c
+		}
+	}
+
+	return ch
+}
+
+// statusText marks a message sent to the "@#chan" part of a channel.
+func statusText(status, text string) string {
+	if status == "" {
+		return text
+	}
+
+	return "[" + status + "] " + text
+}
@@ -0,0 +1,71 @@
+package main
+
+import "testing"
+
+func TestParseISupport(t *testing.T) {
+	tests := []struct {
+		name   string
+		lines  [][]string // RPL_ISUPPORT lines in order
+		eList  string
+		types  string
+		prefix string
+		modes  [4]string
+	}{
+		{
+			name:  "defaults",
+			eList: "", types: "#&", prefix: "ov@+", modes: [4]string{"beI", "k", "l", "imnpst"},
+		},
+		{
+			name:  "ELIST upper cased",
+			lines: [][]string{{"ELIST=cmntu"}},
+			eList: "CMNTU", types: "#&", prefix: "ov@+", modes: [4]string{"beI", "k", "l", "imnpst"},
+		},
+		{
+			name:  "ELIST negated",
+			lines: [][]string{{"ELIST=MU"}, {"-ELIST"}},
+			eList: "", types: "#&", prefix: "ov@+", modes: [4]string{"beI", "k", "l", "imnpst"},
+		},
+		{
+			name:  "tokens over several lines",
+			lines: [][]string{{"CHANTYPES=#", "PREFIX=(qaohv)~&@%+"}, {"CHANMODES=beI,k,l,BCMNORScimnpstz", "ELIST=U"}},
+			eList: "U", types: "#", prefix: "qaohv~&@%+", modes: [4]string{"beI", "k", "l", "BCMNORScimnpstz"},
+		},
+		{
+			name:  "bad PREFIX keeps the default",
+			lines: [][]string{{"PREFIX=(ov)@"}},
+			types: "#&", prefix: "ov@+", modes: [4]string{"beI", "k", "l", "imnpst"},
+		},
+		{
+			name:  "empty PREFIX",
+			lines: [][]string{{"PREFIX="}},
+			types: "#&", prefix: "", modes: [4]string{"beI", "k", "l", "imnpst"},
+		},
+		{
+			name:  "negated CHANMODES",
+			lines: [][]string{{"CHANMODES=b,k,l,n"}, {"-CHANMODES"}},
+			types: "#&", prefix: "ov@+", modes: [4]string{"beI", "k", "l", "imnpst"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := newISupport()
+			for _, ln := range tt.lines {
+				is.parse(ln)
+			}
+
+			if is.eList != tt.eList {
+				t.Errorf("ELIST %q, want %q", is.eList, tt.eList)
+			}
+			if is.chanTypes != tt.types {
+				t.Errorf("CHANTYPES %q, want %q", is.chanTypes, tt.types)
+			}
+			if got := is.prefixModes + is.prefixChars; got != tt.prefix {
+				t.Errorf("PREFIX %q, want %q", got, tt.prefix)
+			}
+			if is.chanModes != tt.modes {
+				t.Errorf("CHANMODES %q, want %q", is.chanModes, tt.modes)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+)
+
+type keyMap struct {
+	// global
+	Quit         key.Binding
+	Help         key.Binding
+	Back         key.Binding
+	Confirm      key.Binding
+	Cancel       key.Binding
+	FocusLeft    key.Binding
+	FocusRight   key.Binding
+	ToggleMouse  key.Binding
+	AcceptInvite key.Binding
+	// servers pane
+	ListUp       key.Binding
+	ListDown     key.Binding
+	Select       key.Binding
+	AddServer    key.Binding
+	DeleteServer key.Binding
+	UndoDelete   key.Binding
+	// form
+	PrevField key.Binding
+	NextField key.Binding
+	Submit    key.Binding
+	// chat
+	ScrollUp   key.Binding
+	ScrollDown key.Binding
+	PageUp     key.Binding
+	PageDown   key.Binding
+	Send       key.Binding
+	// search
+	Search       key.Binding
+	SearchNext   key.Binding
+	SearchPrev   key.Binding
+	GlobalSearch key.Binding
+	// channel list
+	SortList key.Binding
+}
+
+func defaultKeyMap() keyMap {
+	return keyMap{
+		Quit:         key.NewBinding(key.WithKeys("ctrl+c"), key.WithHelp("ctrl+c", "quit")),
+		Help:         key.NewBinding(key.WithKeys("?", "f1"), key.WithHelp("?", "toggle help")),
+		Back:         key.NewBinding(key.WithKeys("esc"), key.WithHelp("esc", "close")),
+		Confirm:      key.NewBinding(key.WithKeys("y", "enter"), key.WithHelp("y", "confirm")),
+		Cancel:       key.NewBinding(key.WithKeys("n", "esc"), key.WithHelp("n/esc", "cancel")),
+		FocusLeft:    key.NewBinding(key.WithKeys("left"), key.WithHelp("←", "servers pane")),
+		FocusRight:   key.NewBinding(key.WithKeys("right"), key.WithHelp("→", "right pane")),
+		ToggleMouse:  key.NewBinding(key.WithKeys("f2"), key.WithHelp("f2", "toggle mouse")),
+		AcceptInvite: key.NewBinding(key.WithKeys("ctrl+o"), key.WithHelp("ctrl+o", "accept invite")),
+		ListUp:       key.NewBinding(key.WithKeys("up", "k"), key.WithHelp("↑/k", "previous entry")),
+		ListDown:     key.NewBinding(key.WithKeys("down", "j"), key.WithHelp("↓/j", "next entry")),
+		Select:       key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "open entry")),
+		AddServer:    key.NewBinding(key.WithKeys("a"), key.WithHelp("a", "add server")),
+		DeleteServer: key.NewBinding(key.WithKeys("d"), key.WithHelp("d", "delete server")),
+		UndoDelete:   key.NewBinding(key.WithKeys("u"), key.WithHelp("u", "undo delete")),
+		PrevField:    key.NewBinding(key.WithKeys("up", "shift+tab"), key.WithHelp("↑", "previous field")),
+		NextField:    key.NewBinding(key.WithKeys("down", "tab"), key.WithHelp("↓", "next field")),
+		Submit:       key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "next / submit")),
+		ScrollUp:     key.NewBinding(key.WithKeys("up"), key.WithHelp("↑", "scroll up")),
+		ScrollDown:   key.NewBinding(key.WithKeys("down"), key.WithHelp("↓", "scroll down")),
+		PageUp:       key.NewBinding(key.WithKeys("pgup"), key.WithHelp("pgup", "half page up")),
+		PageDown:     key.NewBinding(key.WithKeys("pgdown"), key.WithHelp("pgdown", "half page down")),
+		Send:         key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "send")),
+		Search:       key.NewBinding(key.WithKeys("ctrl+f", "/"), key.WithHelp("ctrl+f", "search buffer")),
+		SearchNext:   key.NewBinding(key.WithKeys("n", "enter"), key.WithHelp("n", "next match")),
+		SearchPrev:   key.NewBinding(key.WithKeys("N"), key.WithHelp("N", "previous match")),
+		GlobalSearch: key.NewBinding(key.WithKeys("ctrl+t"), key.WithHelp("ctrl+t", "search all buffers")),
+		SortList:     key.NewBinding(key.WithKeys("tab"), key.WithHelp("tab", "sort channel list")),
+	}
+}
+
+// vimKeyMap moves with alt+hjkl, the ctrl keys vim uses for this
+// (ctrl+h, ctrl+k, ctrl+u, ctrl+e, ctrl+d) edit text in the inputs.
+func vimKeyMap() keyMap {
+	k := defaultKeyMap()
+	k.FocusLeft = key.NewBinding(key.WithKeys("left", "alt+h"), key.WithHelp("alt+h", "servers pane"))
+	k.FocusRight = key.NewBinding(key.WithKeys("right", "alt+l"), key.WithHelp("alt+l", "right pane"))
+	k.PrevField = key.NewBinding(key.WithKeys("up", "shift+tab", "alt+k"), key.WithHelp("alt+k", "previous field"))
+	k.NextField = key.NewBinding(key.WithKeys("down", "tab", "alt+j"), key.WithHelp("alt+j", "next field"))
+	k.ScrollUp = key.NewBinding(key.WithKeys("up", "alt+k", "ctrl+y"), key.WithHelp("alt+k", "scroll up"))
+	k.ScrollDown = key.NewBinding(key.WithKeys("down", "alt+j"), key.WithHelp("alt+j", "scroll down"))
+	k.PageUp = key.NewBinding(key.WithKeys("pgup", "alt+K"), key.WithHelp("alt+K", "half page up"))
+	k.PageDown = key.NewBinding(key.WithKeys("pgdown", "alt+J"), key.WithHelp("alt+J", "half page down"))
+	k.DeleteServer = key.NewBinding(key.WithKeys("x"), key.WithHelp("x", "delete server"))
+	k.Search = key.NewBinding(key.WithKeys("ctrl+f", "/"), key.WithHelp("/", "search buffer"))
+	return k
+}
+
+func emacsKeyMap() keyMap {
+	k := defaultKeyMap()
+	k.Quit = key.NewBinding(key.WithKeys("ctrl+c", "ctrl+q"), key.WithHelp("ctrl+q", "quit"))
+	k.Back = key.NewBinding(key.WithKeys("esc", "ctrl+g"), key.WithHelp("ctrl+g", "close"))
+	k.Cancel = key.NewBinding(key.WithKeys("n", "esc", "ctrl+g"), key.WithHelp("n/ctrl+g", "cancel"))
+	k.UndoDelete = key.NewBinding(key.WithKeys("u", "ctrl+/", "ctrl+_"), key.WithHelp("ctrl+/", "undo delete"))
+	k.FocusLeft = key.NewBinding(key.WithKeys("left", "alt+<"), key.WithHelp("alt+<", "servers pane"))
+	k.FocusRight = key.NewBinding(key.WithKeys("right", "alt+>"), key.WithHelp("alt+>", "right pane"))
+	k.ListUp = key.NewBinding(key.WithKeys("up", "ctrl+p"), key.WithHelp("ctrl+p", "previous entry"))
+	k.ListDown = key.NewBinding(key.WithKeys("down", "ctrl+n"), key.WithHelp("ctrl+n", "next entry"))
+	k.PrevField = key.NewBinding(key.WithKeys("up", "shift+tab", "ctrl+p"), key.WithHelp("ctrl+p", "previous field"))
+	k.NextField = key.NewBinding(key.WithKeys("down", "tab", "ctrl+n"), key.WithHelp("ctrl+n", "next field"))
+	k.ScrollUp = key.NewBinding(key.WithKeys("up", "ctrl+p"), key.WithHelp("ctrl+p", "scroll up"))
+	k.ScrollDown = key.NewBinding(key.WithKeys("down", "ctrl+n"), key.WithHelp("ctrl+n", "scroll down"))
+	k.PageUp = key.NewBinding(key.WithKeys("pgup", "alt+v"), key.WithHelp("alt+v", "half page up"))
+	k.PageDown = key.NewBinding(key.WithKeys("pgdown", "alt+V"), key.WithHelp("alt+V", "half page down")) // ctrl+v pastes
+	k.Search = key.NewBinding(key.WithKeys("ctrl+s", "ctrl+f"), key.WithHelp("ctrl+s", "search buffer"))
+	k.SearchNext = key.NewBinding(key.WithKeys("ctrl+s", "n", "enter"), key.WithHelp("ctrl+s", "next match"))
+	k.SearchPrev = key.NewBinding(key.WithKeys("ctrl+r", "N"), key.WithHelp("ctrl+r", "previous match"))
+	return k
+}
+
+// newKeyMap builds the keymap for the configured preset
+// and applies per-action overrides on top of it.
+func newKeyMap(cfg keysConfig) (keyMap, error) {
+	var k keyMap
+	switch strings.ToLower(cfg.Preset) {
+	case "", "default":
+		k = defaultKeyMap()
+	case "vim":
+		k = vimKeyMap()
+	case "emacs":
+		k = emacsKeyMap()
+	default:
+		return defaultKeyMap(), fmt.Errorf("unknown key preset %q", cfg.Preset)
+	}
+
+	actions := k.actions()
+	names := make([]string, 0, len(cfg.Bindings))
+	for name := range cfg.Bindings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		b, ok := actions[name]
+		if !ok {
+			return k, fmt.Errorf("unknown key action %q", name)
+		}
+
+		var keys []string
+		for _, kn := range cfg.Bindings[name] {
+			if kn == "" {
+				return k, fmt.Errorf("empty key for action %q", name)
+			}
+			if !contains(keys, kn) {
+				keys = append(keys, kn)
+			}
+		}
+
+		if len(keys) == 0 {
+			b.SetEnabled(false)
+			continue
+		}
+
+		b.SetKeys(keys...)
+		b.SetHelp(strings.Join(keys, "/"), b.Help().Desc)
+	}
+
+	return k, nil
+}
+
+// actions maps config action names to bindings.
+func (k *keyMap) actions() map[string]*key.Binding {
+	return map[string]*key.Binding{
+		"quit":          &k.Quit,
+		"help":          &k.Help,
+		"back":          &k.Back,
+		"confirm":       &k.Confirm,
+		"cancel":        &k.Cancel,
+		"focus_left":    &k.FocusLeft,
+		"focus_right":   &k.FocusRight,
+		"toggle_mouse":  &k.ToggleMouse,
+		"accept_invite": &k.AcceptInvite,
+		"list_up":       &k.ListUp,
+		"list_down":     &k.ListDown,
+		"select":        &k.Select,
+		"add_server":    &k.AddServer,
+		"delete_server": &k.DeleteServer,
+		"undo_delete":   &k.UndoDelete,
+		"prev_field":    &k.PrevField,
+		"next_field":    &k.NextField,
+		"submit":        &k.Submit,
+		"scroll_up":     &k.ScrollUp,
+		"scroll_down":   &k.ScrollDown,
+		"page_up":       &k.PageUp,
+		"page_down":     &k.PageDown,
+		"send":          &k.Send,
+		"search":        &k.Search,
+		"search_next":   &k.SearchNext,
+		"search_prev":   &k.SearchPrev,
+		"global_search": &k.GlobalSearch,
+		"sort_list":     &k.SortList,
+	}
+}
+
+func (k keyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.Help, k.FocusLeft, k.FocusRight, k.Quit}
+}
+
+func (k keyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.Quit, k.Help, k.Back, k.Confirm, k.Cancel, k.FocusLeft, k.FocusRight, k.ToggleMouse, k.AcceptInvite},
+		{k.ListUp, k.ListDown, k.Select, k.AddServer, k.DeleteServer, k.UndoDelete},
+		{k.PrevField, k.NextField, k.Submit},
+		{k.ScrollUp, k.ScrollDown, k.PageUp, k.PageDown, k.Send},
+		{k.Search, k.SearchNext, k.SearchPrev, k.GlobalSearch, k.SortList},
+	}
+}
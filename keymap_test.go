@@ -0,0 +1,120 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func press(s string) tea.KeyMsg {
+	switch s {
+	case "enter":
+		return tea.KeyMsg{Type: tea.KeyEnter}
+	case "esc":
+		return tea.KeyMsg{Type: tea.KeyEsc}
+	case "ctrl+x":
+		return tea.KeyMsg{Type: tea.KeyCtrlX}
+	case "ctrl+q":
+		return tea.KeyMsg{Type: tea.KeyCtrlQ}
+	case "ctrl+c":
+		return tea.KeyMsg{Type: tea.KeyCtrlC}
+	}
+
+	alt := strings.HasPrefix(s, "alt+")
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(strings.TrimPrefix(s, "alt+")), Alt: alt}
+}
+
+func TestKeyMapPresets(t *testing.T) {
+	tests := []struct {
+		preset  string
+		binding func(keyMap) key.Binding
+		keys    []string // pressing these triggers the binding
+		not     []string // these don't
+	}{
+		{preset: "", binding: func(k keyMap) key.Binding { return k.DeleteServer }, keys: []string{"d"}, not: []string{"x"}},
+		{preset: "Default", binding: func(k keyMap) key.Binding { return k.Quit }, keys: []string{"ctrl+c"}, not: []string{"ctrl+q"}},
+		{preset: "vim", binding: func(k keyMap) key.Binding { return k.DeleteServer }, keys: []string{"x"}, not: []string{"d"}},
+		{preset: "vim", binding: func(k keyMap) key.Binding { return k.FocusLeft }, keys: []string{"alt+h"}},
+		{preset: "vim", binding: func(k keyMap) key.Binding { return k.PageDown }, keys: []string{"alt+J"}, not: []string{"alt+j"}},
+		{preset: "emacs", binding: func(k keyMap) key.Binding { return k.Quit }, keys: []string{"ctrl+c", "ctrl+q"}},
+		{preset: "EMACS", binding: func(k keyMap) key.Binding { return k.ListDown }, keys: []string{"ctrl+n"}, not: []string{"j"}},
+	}
+
+	for _, tt := range tests {
+		k, err := newKeyMap(keysConfig{Preset: tt.preset})
+		if err != nil {
+			t.Fatalf("%q: %v", tt.preset, err)
+		}
+
+		b := tt.binding(k)
+		for _, s := range tt.keys {
+			if !key.Matches(press(s), b) {
+				t.Errorf("%q: %s doesn't trigger %q", tt.preset, s, b.Help().Desc)
+			}
+		}
+		for _, s := range tt.not {
+			if key.Matches(press(s), b) {
+				t.Errorf("%q: %s triggers %q", tt.preset, s, b.Help().Desc)
+			}
+		}
+	}
+}
+
+func TestKeyMapOverrides(t *testing.T) {
+	k, err := newKeyMap(keysConfig{Preset: "vim", Bindings: map[string][]string{
+		"delete_server": {"ctrl+x"},
+		"add_server":    {"n", "n"}, // the same key twice counts once
+		"toggle_mouse":  {},
+		"select":        {"enter"}, // already bound to other actions too
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !key.Matches(press("ctrl+x"), k.DeleteServer) || key.Matches(press("x"), k.DeleteServer) {
+		t.Errorf("delete_server bound to %q", k.DeleteServer.Keys())
+	}
+	if h := k.DeleteServer.Help(); h.Key != "ctrl+x" || h.Desc != "delete server" {
+		t.Errorf("delete_server help %+v", h)
+	}
+	if got := k.AddServer.Keys(); len(got) != 1 || got[0] != "n" || k.AddServer.Help().Key != "n" {
+		t.Errorf("add_server bound to %q, help %q", got, k.AddServer.Help().Key)
+	}
+	if k.ToggleMouse.Enabled() {
+		t.Error("empty key list left toggle_mouse on")
+	}
+	if !key.Matches(press("enter"), k.Select) || !key.Matches(press("enter"), k.Send) {
+		t.Error("a shared key taken away from another action")
+	}
+	// the rest of the preset stays
+	if !key.Matches(press("alt+h"), k.FocusLeft) {
+		t.Errorf("focus_left bound to %q", k.FocusLeft.Keys())
+	}
+}
+
+func TestKeyMapErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     keysConfig
+		wantErr string
+	}{
+		{name: "unknown preset", cfg: keysConfig{Preset: "nano"}, wantErr: `unknown key preset "nano"`},
+		{name: "unknown action", cfg: keysConfig{Bindings: map[string][]string{"launch": {"l"}}}, wantErr: `unknown key action "launch"`},
+		{name: "empty key", cfg: keysConfig{Bindings: map[string][]string{"quit": {"ctrl+c", ""}}}, wantErr: `empty key for action "quit"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := newKeyMap(tt.cfg)
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("error %v, want %q", err, tt.wantErr)
+			}
+			// what comes back is still usable
+			if !key.Matches(press("ctrl+c"), k.Quit) {
+				t.Errorf("quit bound to %q", k.Quit.Keys())
+			}
+		})
+	}
+}
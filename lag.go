@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/lrstanley/girc"
+)
+
+const lagToken = "clirc-lag-"
+
+type lagConfig struct {
+	IntervalSeconds int  `json:"interval_seconds,omitempty"` // between checks, 15 by default
+	WarnMillis      int  `json:"warn_ms,omitempty"`          // lag worth a warning, 2000 by default
+	StallSeconds    int  `json:"stall_seconds,omitempty"`    // unanswered this long means stalled, 90 by default
+	NoReconnect     bool `json:"no_reconnect,omitempty"`     // only report stalled connections
+}
+
+func (c lagConfig) interval() time.Duration {
+	if c.IntervalSeconds > 0 {
+		return time.Duration(c.IntervalSeconds) * time.Second
+	}
+
+	return 15 * time.Second
+}
+
+func (c lagConfig) warn() time.Duration {
+	if c.WarnMillis > 0 {
+		return time.Duration(c.WarnMillis) * time.Millisecond
+	}
+
+	return 2 * time.Second
+}
+
+func (c lagConfig) stall() time.Duration {
+	if c.StallSeconds > 0 {
+		return time.Duration(c.StallSeconds) * time.Second
+	}
+
+	return 90 * time.Second
+}
+
+// lagMeter is the connection health of a server. It is shared by the
+// entry and its list items, and only touched from Update.
+type lagMeter struct {
+	live   bool          // registered and not yet disconnected
+	lag    time.Duration // last round trip, 0 before the first
+	sent   time.Time     // PING in flight, zero when answered
+	token  string
+	warned bool
+	report bool // /lag waits for this answer
+}
+
+type lagTickMsg struct{}
+
+// lagMsg is the PONG to one of our PINGs.
+type lagMsg struct {
+	id    serverID
+	token string
+	at    time.Time
+}
+
+func lagTick(d time.Duration) tea.Cmd {
+	return tea.Tick(d, func(time.Time) tea.Msg { return lagTickMsg{} })
+}
+
+func addLagHandlers(c *girc.Client, id serverID) {
+	c.Handlers.Add(girc.PONG, func(_ *girc.Client, e girc.Event) {
+		if token := e.Last(); strings.HasPrefix(token, lagToken) {
+			program.Send(lagMsg{id: id, token: token, at: time.Now()})
+		}
+	})
+}
+
+// ping sends a lag check unless one is in flight.
+func (h *lagMeter) ping(s *serverEntry) {
+	if !h.sent.IsZero() || s.client == nil || !s.connected {
+		return
+	}
+
+	h.sent = time.Now()
+	h.token = lagToken + strconv.FormatInt(h.sent.UnixNano(), 10)
+	s.client.Cmd.Ping(h.token)
+}
+
+// current is the lag to show, an unanswered PING older than the
+// last round trip counts as lag already.
+func (h *lagMeter) current() time.Duration {
+	if !h.sent.IsZero() {
+		return max(h.lag, time.Since(h.sent))
+	}
+
+	return h.lag
+}
+
+// checkLag runs on every tick, it pings the servers and reconnects
+// those that stopped answering. The chat is only redrawn when the open
+// server got a warning, scrollback stays where it is.
+func (m *model) checkLag() tea.Cmd {
+	var cmds []tea.Cmd
+	changed := false
+	for _, s := range m.servers {
+		h := s.health
+		if s.client == nil || !s.connected || s.replay != nil {
+			continue
+		}
+
+		if h.sent.IsZero() {
+			h.ping(s)
+			continue
+		}
+
+		waited := time.Since(h.sent)
+		if waited > m.cfg.Lag.warn() && !h.warned {
+			h.warned = true
+			m.pushSysLine(s.id, "_sys", "!! "+s.name+" has not answered for "+formatLag(waited))
+			changed = changed || s.id == m.activeID
+		}
+
+		if waited < m.cfg.Lag.stall() {
+			continue
+		}
+
+		changed = changed || s.id == m.activeID
+
+		if m.cfg.Lag.NoReconnect {
+			m.pushSysLine(s.id, "_sys", "!! connection to "+s.name+" stalled, no answer for "+formatLag(waited))
+			h.sent = time.Now() // report again after another stall period
+			continue
+		}
+
+		m.pushSysLine(s.id, "_sys", "!! connection to "+s.name+" stalled, no answer for "+formatLag(waited)+", reconnecting")
+		s.client.Close()
+		s.connected, h.live, h.sent = false, false, time.Time{}
+		m.requeueMessages(s)
+		cmds = append(cmds, connectServerCmd(s.id))
+	}
+
+	if changed && m.mode == modeChat {
+		m.refreshChatKeepOffset()
+	}
+
+	cmds = append(cmds, lagTick(m.cfg.Lag.interval()))
+	return tea.Batch(cmds...)
+}
+
+func (m *model) applyLag(msg lagMsg) {
+	s, ok := m.servers[msg.id]
+	if !ok || s.health.token != msg.token || s.health.sent.IsZero() {
+		return
+	}
+
+	h := s.health
+	m.confirmSent(s, h.sent) // the server had what we sent before the PING
+	h.lag, h.sent = msg.at.Sub(h.sent), time.Time{}
+	changed := true
+	switch {
+	case h.lag > m.cfg.Lag.warn() && !h.warned:
+		h.warned = true
+		m.pushSysLine(s.id, "_sys", "!! lag to "+s.name+" is "+formatLag(h.lag))
+	case h.lag <= m.cfg.Lag.warn() && h.warned:
+		h.warned = false
+		m.pushSysLine(s.id, "_sys", "-- lag to "+s.name+" back to "+formatLag(h.lag)+" --")
+	default:
+		changed = false
+	}
+
+	if h.report {
+		h.report = false
+		ch := "_sys"
+		if m.activeID == s.id {
+			ch = m.activeChan
+		}
+		m.pushSysLine(s.id, ch, "-- lag to "+s.name+": "+formatLag(h.lag)+" --")
+		changed = true
+	}
+
+	if changed && m.mode == modeChat && m.activeID == s.id {
+		m.refreshChatKeepOffset()
+	}
+}
+
+// lagCmd implements /lag, it lists every server and measures the current one.
+func (m *model) lagCmd(s *serverEntry) []string {
+	ids := make([]serverID, 0, len(m.servers))
+	for id := range m.servers {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	out := []string{"-- lag --"}
+	for _, id := range ids {
+		other := m.servers[id]
+		status := "not connected"
+		if other.connected {
+			status = "measuring"
+			if other.health.lag > 0 || !other.health.sent.IsZero() {
+				status = formatLag(other.health.current())
+			}
+		}
+		out = append(out, fmt.Sprintf("%s: %s", other.name, status))
+	}
+
+	if s.client == nil || !s.connected {
+		return out
+	}
+
+	s.health.report = true
+	s.health.ping(s)
+	return out
+}
+
+// lagBadge is the lag as shown next to a server, empty while unknown.
+func (m *model) lagBadge(h *lagMeter) string {
+	if !h.live || (h.lag == 0 && h.sent.IsZero()) {
+		return ""
+	}
+
+	lag := h.current()
+	if lag > m.cfg.Lag.warn() {
+		return stylePinkB.Render("lag " + formatLag(lag))
+	}
+
+	return styleDim.Render(formatLag(lag))
+}
+
+func formatLag(d time.Duration) string {
+	if d < time.Second {
+		return strconv.FormatInt(d.Milliseconds(), 10) + "ms"
+	}
+
+	return strconv.FormatFloat(d.Seconds(), 'f', 1, 64) + "s"
+}
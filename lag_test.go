@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lrstanley/girc"
+)
+
+func TestFormatLag(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "0ms"},
+		{42 * time.Millisecond, "42ms"},
+		{999 * time.Millisecond, "999ms"},
+		{time.Second, "1.0s"},
+		{1540 * time.Millisecond, "1.5s"},
+		{90 * time.Second, "90.0s"},
+	}
+
+	for _, tt := range tests {
+		if got := formatLag(tt.d); got != tt.want {
+			t.Errorf("formatLag(%s) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+// lagTestModel has a connected server and a long channel to scroll in.
+func lagTestModel(t *testing.T) (model, *serverEntry) {
+	t.Helper()
+	m := newTestModel(t, "#a")
+	m.mode, m.activeID, m.activeChan = modeChat, 1, "#a"
+	m.cfg.Lag = lagConfig{WarnMillis: 500, StallSeconds: 60}
+	s := m.servers[1]
+	s.client = girc.New(girc.Config{Server: "test", Nick: "me", User: "me"})
+	s.connected, s.health.live = true, true
+	for i := range 200 {
+		s.channelLogs["#a"] = append(s.channelLogs["#a"], chatLine{at: time.Now(), text: fmt.Sprintf("line %d", i)})
+	}
+	m.refreshChat()
+	return m, s
+}
+
+func sysLines(s *serverEntry) string {
+	var out []string
+	for _, ln := range s.channelLogs["_sys"] {
+		out = append(out, ln.text)
+	}
+
+	return strings.Join(out, "\n")
+}
+
+func TestApplyLagTransitions(t *testing.T) {
+	m, s := lagTestModel(t)
+	answer := func(after time.Duration) {
+		t.Helper()
+		h := s.health
+		h.sent = time.Now().Add(-after)
+		h.token = lagToken + "x"
+		m.applyLag(lagMsg{id: 1, token: h.token, at: h.sent.Add(after)})
+	}
+
+	answer(100 * time.Millisecond)
+	if s.health.warned || strings.Contains(sysLines(s), "lag") {
+		t.Fatalf("warned at 100ms: %q", sysLines(s))
+	}
+
+	answer(2 * time.Second)
+	if !s.health.warned || !strings.Contains(sysLines(s), "!! lag to fake is 2.0s") {
+		t.Fatalf("no warning at 2s: %q", sysLines(s))
+	}
+
+	answer(3 * time.Second)
+	if n := strings.Count(sysLines(s), "!! lag"); n != 1 {
+		t.Errorf("warned %d times", n)
+	}
+
+	answer(200 * time.Millisecond)
+	if s.health.warned || !strings.Contains(sysLines(s), "-- lag to fake back to 200ms --") {
+		t.Errorf("no all-clear: %q", sysLines(s))
+	}
+
+	// an answer to someone else's PING changes nothing
+	s.health.sent, s.health.token = time.Now(), lagToken+"mine"
+	m.applyLag(lagMsg{id: 1, token: lagToken + "other", at: time.Now()})
+	if s.health.sent.IsZero() {
+		t.Error("foreign PONG taken as ours")
+	}
+}
+
+func TestLagKeepsScrollback(t *testing.T) {
+	m, s := lagTestModel(t)
+	m.chatVP.SetYOffset(10)
+
+	// a quiet PONG and a tick with a PING in flight redraw nothing
+	s.health.sent, s.health.token = time.Now().Add(-50*time.Millisecond), lagToken+"x"
+	m.applyLag(lagMsg{id: 1, token: lagToken + "x", at: time.Now()})
+	m.checkLag()
+	m.checkLag()
+	if m.chatVP.YOffset != 10 {
+		t.Fatalf("scrolled to %d by lag checks", m.chatVP.YOffset)
+	}
+
+	// a warning in the open buffer keeps the reader where they are
+	m.activeChan = "_sys"
+	for range 100 {
+		m.pushSysLine(1, "_sys", "old")
+	}
+	m.refreshChat()
+	m.chatVP.SetYOffset(10)
+	s.health.sent = time.Now().Add(-time.Second)
+	m.checkLag()
+	if !s.health.warned {
+		t.Fatal("no warning after 1s without an answer")
+	}
+	if m.chatVP.YOffset != 10 {
+		t.Errorf("scrolled to %d by the warning", m.chatVP.YOffset)
+	}
+}
+
+func TestCheckLagStall(t *testing.T) {
+	m, s := lagTestModel(t)
+	m.cfg.Flood = floodConfig{Disabled: true}
+	m.sendMessage(s, "#a", "lost")
+	s.health.sent = time.Now().Add(-2 * time.Minute)
+
+	if cmd := m.checkLag(); cmd == nil {
+		t.Fatal("no reconnect")
+	}
+	if s.connected || s.health.live || !s.health.sent.IsZero() {
+		t.Errorf("still connected %v, live %v", s.connected, s.health.live)
+	}
+	if !strings.Contains(sysLines(s), "stalled, no answer for 120") {
+		t.Errorf("no stall notice: %q", sysLines(s))
+	}
+	if len(s.outbox["#a"]) != 1 || s.outbox["#a"][0].text != "lost" {
+		t.Errorf("outbox %+v", s.outbox)
+	}
+
+	// only reported with no_reconnect
+	m, s = lagTestModel(t)
+	m.cfg.Lag.NoReconnect = true
+	s.health.sent = time.Now().Add(-2 * time.Minute)
+	m.checkLag()
+	if !s.connected || time.Since(s.health.sent) > time.Second {
+		t.Error("no_reconnect dropped the connection or the stall timer")
+	}
+}
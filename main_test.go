@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "clirc-test")
+	if err != nil {
+		panic(err)
+	}
+
+	// keep the tests away from the real config and secrets
+	os.Setenv(configEnv, filepath.Join(dir, "config.json"))
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// newTestModel is a sized model with one server, "fake", joined to chans.
+func newTestModel(t *testing.T, chans ...string) model {
+	t.Helper()
+	keys, err := newKeyMap(keysConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := initialModel(config{}, keys)
+	m.unlock = nil
+	s := newServerEntry(1, formCfg{Name: "fake", Address: "127.0.0.1:6667", Nick: "me", Chans: chans})
+	m.servers[1] = s
+	m.nextID = 2
+	m.serverList.SetItems(append(s.listItems(), addServerItem{}))
+	next, _ := m.Update(tea.WindowSizeMsg{Width: 120, Height: 40})
+	return next.(model)
+}
+
+// captureModel hands every message it gets to the test.
+type captureModel chan tea.Msg
+
+func (c captureModel) Init() tea.Cmd { return nil }
+
+func (c captureModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	c <- msg
+	return c, nil
+}
+
+func (c captureModel) View() string { return "" }
+
+// captureProgram runs a program that collects what connection handlers
+// send to the UI, for the length of the test.
+func captureProgram(t *testing.T) <-chan tea.Msg {
+	t.Helper()
+	msgs := make(captureModel, 64)
+	p := tea.NewProgram(msgs, tea.WithInput(nil), tea.WithOutput(io.Discard), tea.WithoutRenderer(), tea.WithoutSignalHandler())
+	done := make(chan struct{})
+	go func() {
+		p.Run()
+		close(done)
+	}()
+
+	program = p
+	t.Cleanup(func() {
+		p.Quit()
+		<-done
+		program = nil
+	})
+	return msgs
+}
+
+// nextMsg waits for the next message of type T, skipping others.
+func nextMsg[T tea.Msg](t *testing.T, msgs <-chan tea.Msg) T {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case msg := <-msgs:
+			if m, ok := msg.(T); ok {
+				return m
+			}
+		case <-timeout:
+			var zero T
+			t.Fatalf("no %T sent", zero)
+			return zero
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const wheelStep = 3
+
+func (m model) updateMouse(msg tea.MouseMsg) (tea.Model, tea.Cmd) {
+	inLeft := msg.X < m.leftWidth+2
+	switch msg.Button {
+	case tea.MouseButtonWheelUp, tea.MouseButtonWheelDown:
+		up := msg.Button == tea.MouseButtonWheelUp
+		if inLeft {
+			for range wheelStep {
+				if up {
+					m.serverList.CursorUp()
+				} else {
+					m.serverList.CursorDown()
+				}
+			}
+			return m, nil
+		}
+
+		switch m.mode {
+		case modeChat:
+			if m.showNickList() && msg.X >= m.nickListLeft()-1 {
+				if up {
+					m.scrollNickList(-wheelStep)
+				} else {
+					m.scrollNickList(wheelStep)
+				}
+				return m, nil
+			}
+
+			if up && m.chatVP.AtTop() {
+				m.requestOlderHistory()
+			}
+
+			if up {
+				m.chatVP.ScrollUp(wheelStep)
+			} else {
+				m.chatVP.ScrollDown(wheelStep)
+			}
+		case modeSearch:
+			if up {
+				m.results.CursorUp()
+			} else {
+				m.results.CursorDown()
+			}
+		case modeList:
+			if up {
+				m.chanList.table.MoveUp(wheelStep)
+			} else {
+				m.chanList.table.MoveDown(wheelStep)
+			}
+		}
+		return m, nil
+	case tea.MouseButtonLeft:
+		if msg.Action != tea.MouseActionPress {
+			return m, nil
+		}
+
+		if !inLeft {
+			if m.focus != paneRight {
+				m.focus = paneRight
+				m.focusRight()
+			}
+			if nick, ok := m.nickAt(msg.X, msg.Y); ok {
+				m.clickNick(nick)
+			}
+			return m, nil
+		}
+
+		if m.focus != paneServers {
+			m.focus = paneServers
+			m.blurRight()
+		}
+
+		idx, ok := m.serverListIndexAt(msg.Y)
+		if !ok {
+			return m, nil
+		}
+
+		// a click on the selected entry opens it
+		if idx == m.serverList.Index() {
+			return m.updateServersPane(tea.KeyMsg{Type: tea.KeyEnter})
+		}
+
+		m.serverList.Select(idx)
+	}
+
+	return m, nil
+}
+
+// paneTop is the first screen row inside the pane borders.
+func (m *model) paneTop() int {
+	return lipgloss.Height(m.viewTopSpacer()) + box.GetBorderTopSize()
+}
+
+// serverListTop is the screen row of the first server list item.
+func (m *model) serverListTop() int {
+	return m.paneTop() + lipgloss.Height(m.viewLeftHeader())
+}
+
+// chatBodyTop is the screen row of the first chat line.
+func (m *model) chatBodyTop() int {
+	return m.paneTop() + lipgloss.Height(m.viewChatHeader())
+}
+
+// serverListIndexAt maps a screen row to a server list item.
+func (m *model) serverListIndexAt(y int) (int, bool) {
+	row := y - m.serverListTop()
+	if row < 0 || m.rowH <= 0 {
+		return 0, false
+	}
+
+	p := m.serverList.Paginator
+	idx := p.Page*p.PerPage + row/m.rowH
+	if row/m.rowH >= p.ItemsOnPage(len(m.serverList.Items())) {
+		return 0, false
+	}
+
+	return idx, true
+}
+
+func (m *model) toggleMouse() tea.Cmd {
+	m.mouse = !m.mouse
+	if m.mouse {
+		return tea.EnableMouseCellMotion
+	}
+
+	return tea.DisableMouse
+}
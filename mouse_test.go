@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// screenPos finds text on the rendered screen.
+func screenPos(t *testing.T, m model, text string) (x, y int) {
+	t.Helper()
+	for y, ln := range strings.Split(ansi.Strip(m.View()), "\n") {
+		if i := strings.Index(ln, text); i >= 0 {
+			return ansi.StringWidth(ln[:i]), y
+		}
+	}
+
+	t.Fatalf("%q not on screen", text)
+	return 0, 0
+}
+
+func TestServerListIndexAt(t *testing.T) {
+	m := newTestModel(t, "#go")
+	_, y := screenPos(t, m, "fake")
+	if got := m.serverListTop(); got != y {
+		t.Fatalf("serverListTop = %d, first item on row %d", got, y)
+	}
+
+	if idx, ok := m.serverListIndexAt(y); !ok || idx != 0 {
+		t.Errorf("serverListIndexAt(%d) = %d, %v", y, idx, ok)
+	}
+
+	if _, ok := m.serverListIndexAt(y - 1); ok {
+		t.Errorf("row above the list maps to an item")
+	}
+}
+
+func TestNickClick(t *testing.T) {
+	m := newTestModel(t, "#go")
+	s := m.servers[1]
+	for _, n := range []string{"bob", "alice", "carol"} {
+		s.addMember("#go", n)
+	}
+	m.mode, m.activeID, m.activeChan = modeChat, 1, "#go"
+	m.refreshChat()
+	if !m.showNickList() {
+		t.Fatal("no nick column")
+	}
+
+	x, y := screenPos(t, m, "bob")
+	if nick, ok := m.nickAt(x, y); !ok || nick != "bob" {
+		t.Fatalf("nickAt(%d, %d) = %q, %v", x, y, nick, ok)
+	}
+	if _, ay := screenPos(t, m, "alice"); ay != y-1 {
+		t.Errorf("alice on row %d, want %d", ay, y-1)
+	}
+
+	click := tea.MouseMsg{X: x, Y: y, Button: tea.MouseButtonLeft, Action: tea.MouseActionPress}
+	next, _ := m.updateMouse(click)
+	m = next.(model)
+	if m.nickSel != "bob" {
+		t.Fatalf("selected %q", m.nickSel)
+	}
+
+	next, _ = m.updateMouse(click)
+	m = next.(model)
+	if got := m.chatInput.Value(); got != "bob: " {
+		t.Errorf("input %q after the second click", got)
+	}
+
+	// the system buffer has no nick column
+	m.activeChan = "_sys"
+	m.refreshChat()
+	if m.showNickList() {
+		t.Error("nick column beside _sys")
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/lrstanley/girc"
+)
+
+// how the primary nick is recovered from services
+const (
+	regainCmd   = "regain" // NickServ REGAIN, one step
+	regainGhost = "ghost"  // NickServ GHOST, then NICK
+)
+
+const ghostDelay = 2 * time.Second
+
+// nickMsg reports our nick changing from old to nick,
+// old is empty when the server assigns it on registration.
+type nickMsg struct {
+	id     serverID
+	old    string
+	nick   string
+	source string
+	at     time.Time
+}
+
+func parseRegain(s string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "off", "no":
+		return "", nil
+	case regainCmd:
+		return regainCmd, nil
+	case regainGhost:
+		return regainGhost, nil
+	}
+
+	return "", fmt.Errorf("recover nick: want regain, ghost or off")
+}
+
+// me is the nick we go by on the server right now.
+func (s *serverEntry) me() string {
+	if s.curNick != "" {
+		return s.curNick
+	}
+
+	return s.nick
+}
+
+func (s *serverEntry) isMe(nick string) bool {
+	return s.support.equal(nick, s.me())
+}
+
+// nickCandidate is the nth nick tried while registering.
+func (s *serverEntry) nickCandidate(n int) string {
+	if n < len(s.altNicks) {
+		return s.altNicks[n]
+	}
+
+	return s.nick + strings.Repeat("_", n-len(s.altNicks)+1)
+}
+
+// addNickHandlers tracks our nick and walks the alternate nicks when
+// the nick is taken during registration. girc's own collision handling
+// is turned off in the config.
+func addNickHandlers(c *girc.Client, id serverID, s *serverEntry) {
+	var registered atomic.Bool
+	tried := 0
+	collide := func(cl *girc.Client, e girc.Event) {
+		taken := cl.GetNick()
+		if len(e.Params) > 1 {
+			taken = e.Params[1]
+		}
+
+		if registered.Load() {
+			if s.support.isChannel(taken) {
+				return // 437 for a channel
+			}
+			program.Send(ircChanLineMsg{id: id, channel: "_sys", line: styleDim.Render("-- nick " + taken + " is not available --")})
+			return
+		}
+
+		next := s.nickCandidate(tried)
+		tried++
+		program.Send(ircChanLineMsg{id: id, channel: "_sys", line: styleDim.Render("-- nick " + taken + " is not available, trying " + next + " --")})
+		sendFromHandler(cl, id, &girc.Event{Command: girc.NICK, Params: []string{next}})
+	}
+
+	for _, ev := range []string{girc.ERR_NICKNAMEINUSE, girc.ERR_NICKCOLLISION, girc.ERR_UNAVAILRESOURCE} {
+		c.Handlers.Add(ev, collide)
+	}
+
+	c.Handlers.Add(girc.RPL_WELCOME, func(_ *girc.Client, e girc.Event) {
+		registered.Store(true)
+		if len(e.Params) > 0 {
+			program.Send(nickMsg{id: id, nick: e.Params[0]})
+		}
+	})
+	c.Handlers.Add(girc.NICK, func(_ *girc.Client, e girc.Event) {
+		if e.Source != nil && len(e.Params) > 0 {
+			program.Send(nickMsg{id: id, old: e.Source.Name, nick: e.Last(), source: e.Source.String(), at: e.Timestamp})
+		}
+	})
+}
+
+// applyNick follows our own nick and renames others in the roster,
+// the change is shown in the channels shared with them.
+func (m *model) applyNick(msg nickMsg) {
+	s, ok := m.servers[msg.id]
+	if !ok {
+		return
+	}
+
+	if msg.old != "" {
+		self := s.isMe(msg.old)
+		chans := s.renameMember(msg.old, msg.nick)
+		if self || !m.ignored(s, msg.source, classJoins) {
+			line := styleDim.Render(fmt.Sprintf("[%s] * %s is now known as %s", stamp(msg.at), msg.old, msg.nick))
+			for _, ch := range chans {
+				m.applyChanLine(ircChanLineMsg{id: s.id, channel: ch, line: line, at: msg.at})
+			}
+		}
+
+		if !self {
+			return
+		}
+	}
+
+	switch {
+	case msg.old == "":
+		if msg.nick != s.nick {
+			m.pushSysLine(s.id, "_sys", "-- registered as "+msg.nick+" instead of "+s.nick+" --")
+		}
+	default:
+		m.pushSysLine(s.id, "_sys", "-- you are now known as "+msg.nick+" --")
+	}
+
+	s.curNick = msg.nick
+	if m.mode == modeChat && m.activeID == s.id {
+		m.refreshChat()
+	}
+}
+
+// regainNick asks NickServ to free the primary nick through send,
+// it expects us to be identified already (SASL, CertFP or a perform line).
+func regainNick(c *girc.Client, s *serverEntry, how string, send func(*girc.Event)) bool {
+	if s.support.equal(c.GetNick(), s.nick) {
+		return false
+	}
+
+	switch how {
+	case regainCmd:
+		send(&girc.Event{Command: girc.PRIVMSG, Params: []string{"NickServ", "REGAIN " + s.nick}})
+	case regainGhost:
+		send(&girc.Event{Command: girc.PRIVMSG, Params: []string{"NickServ", "GHOST " + s.nick}})
+		time.AfterFunc(ghostDelay, func() {
+			sendFromHandler(c, s.id, &girc.Event{Command: girc.NICK, Params: []string{s.nick}})
+		})
+	default:
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/x/ansi"
+	"github.com/lrstanley/girc"
+)
+
+func TestNickCandidate(t *testing.T) {
+	tests := []struct {
+		alts []string
+		want []string
+	}{
+		{want: []string{"me_", "me__", "me___"}},
+		{alts: []string{"alt"}, want: []string{"alt", "me_", "me__"}},
+		{alts: []string{"a1", "a2"}, want: []string{"a1", "a2", "me_"}},
+	}
+
+	for _, tt := range tests {
+		s := &serverEntry{nick: "me", altNicks: tt.alts}
+		var got []string
+		for n := range tt.want {
+			got = append(got, s.nickCandidate(n))
+		}
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("%q: got %q, want %q", tt.alts, got, tt.want)
+		}
+	}
+}
+
+func TestNickInUse(t *testing.T) {
+	msgs := captureProgram(t)
+	s := newServerEntry(1, formCfg{Name: "fake", Address: "127.0.0.1:6667", Nick: "me", AltNicks: []string{"alt"}})
+	c := girc.New(girc.Config{Server: "test", Nick: "me", User: "me", HandleNickCollide: func(string) string { return "" }})
+	addNickHandlers(c, 1, s)
+
+	// while registering, the alternates then the nick with underscores
+	for _, want := range []string{"alt", "me_"} {
+		c.RunHandlers(girc.ParseEvent(":srv 433 * me :Nickname is already in use"))
+		line := nextMsg[ircChanLineMsg](t, msgs)
+		if got := ansi.Strip(line.line); got != "-- nick me is not available, trying "+want+" --" {
+			t.Errorf("shown %q", got)
+		}
+		if e := nextMsg[sendLineMsg](t, msgs).e; e.Command != girc.NICK || e.Params[0] != want {
+			t.Errorf("sent %s", e)
+		}
+	}
+
+	c.RunHandlers(girc.ParseEvent(":srv 001 me_ :welcome"))
+	if msg := nextMsg[nickMsg](t, msgs); msg.nick != "me_" || msg.old != "" {
+		t.Errorf("registered as %+v", msg)
+	}
+
+	// once registered, a refused /nick is only reported
+	c.RunHandlers(girc.ParseEvent(":srv 433 me_ other :Nickname is already in use"))
+	if got := ansi.Strip(nextMsg[ircChanLineMsg](t, msgs).line); got != "-- nick other is not available --" {
+		t.Errorf("shown %q", got)
+	}
+	c.RunHandlers(girc.ParseEvent(":srv 437 me_ #chan :Channel is temporarily unavailable"))
+	c.RunHandlers(girc.ParseEvent(":me_!u@h NICK :other"))
+	if msg := nextMsg[nickMsg](t, msgs); msg.old != "me_" || msg.nick != "other" {
+		t.Errorf("nick change %+v", msg)
+	}
+	select {
+	case msg := <-msgs:
+		if _, ok := msg.(sendLineMsg); ok {
+			t.Errorf("sent %v after registering", msg)
+		}
+	default:
+	}
+}
+
+func TestApplyNick(t *testing.T) {
+	m := newTestModel(t, "#a", "#b")
+	s := m.servers[1]
+	s.members = map[string]map[string]bool{
+		"#a": {"me_": true, "bob": true},
+		"#b": {"me_": true},
+	}
+
+	m.applyNick(nickMsg{id: 1, nick: "me_"})
+	if s.me() != "me_" || !strings.Contains(sysLines(s), "-- registered as me_ instead of me --") {
+		t.Fatalf("nick %q, shown %q", s.me(), sysLines(s))
+	}
+
+	// someone else: renamed in the roster, shown where they are
+	m.applyNick(nickMsg{id: 1, old: "bob", nick: "robert", source: "bob!b@h"})
+	if !s.members["#a"]["robert"] || s.members["#a"]["bob"] {
+		t.Errorf("roster %v", s.members["#a"])
+	}
+	if n := len(s.channelLogs["#b"]); n != 0 {
+		t.Errorf("%d lines in #b", n)
+	}
+	if s.me() != "me_" {
+		t.Errorf("our nick became %q", s.me())
+	}
+
+	// ourselves
+	m.applyNick(nickMsg{id: 1, old: "me_", nick: "me"})
+	if s.me() != "me" || !strings.Contains(sysLines(s), "-- you are now known as me --") {
+		t.Errorf("nick %q, shown %q", s.me(), sysLines(s))
+	}
+	for _, ch := range []string{"#a", "#b"} {
+		logs := s.channelLogs[ch]
+		if len(logs) == 0 || !strings.HasSuffix(ansi.Strip(logs[len(logs)-1].text), "* me_ is now known as me") {
+			t.Errorf("%s: %d lines", ch, len(logs))
+		}
+	}
+}
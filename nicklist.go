@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+const (
+	nickListWidth = 16 // nick column beside channel buffers, its border not counted
+	minChatWidth  = 40 // narrower chats hide the nick column
+)
+
+var nickColumn = lipgloss.NewStyle().
+	Width(nickListWidth).
+	PaddingLeft(1).
+	BorderStyle(lipgloss.NormalBorder()).
+	BorderLeft(true).
+	BorderForeground(pink)
+
+// nickList is the roster of the active channel in display order.
+func (m *model) nickList() []string {
+	s, ok := m.servers[m.activeID]
+	if !ok || !s.support.isChannel(m.activeChan) {
+		return nil
+	}
+
+	nicks := make([]string, 0, len(s.members[m.activeChan]))
+	for n := range s.members[m.activeChan] {
+		nicks = append(nicks, n)
+	}
+	sort.Slice(nicks, func(i, j int) bool { return s.support.fold(nicks[i]) < s.support.fold(nicks[j]) })
+	return nicks
+}
+
+// showNickList reports whether refreshChat left room for the nick column.
+func (m *model) showNickList() bool {
+	return m.chatVP.Width < m.chatW
+}
+
+// layoutChat narrows the chat for the nick column of a channel.
+func (m *model) layoutChat() {
+	m.chatVP.Width = m.chatW
+	n := len(m.nickList())
+	if n > 0 && m.chatW-nickColumn.GetHorizontalBorderSize()-nickListWidth >= minChatWidth {
+		m.chatVP.Width = m.chatW - nickColumn.GetHorizontalBorderSize() - nickListWidth
+	}
+
+	m.nickTop = max(min(m.nickTop, n-m.chatVP.Height), 0)
+}
+
+func (m model) viewNickList() string {
+	nicks := m.nickList()
+	h := m.chatVP.Height
+	end := min(m.nickTop+h, len(nicks))
+	rows := make([]string, 0, h)
+	for _, n := range nicks[m.nickTop:end] {
+		n = ansi.Truncate(n, nickListWidth-1, "…")
+		if n == m.nickSel {
+			rows = append(rows, styleDarkSel.Render(n))
+		} else {
+			rows = append(rows, stylePink.Render(n))
+		}
+	}
+
+	if more := len(nicks) - end; more > 0 && len(rows) > 0 {
+		rows[len(rows)-1] = styleDim.Render(fmt.Sprintf("… %d more", more+1))
+	}
+
+	return nickColumn.Height(h).Render(strings.Join(rows, "\n"))
+}
+
+// nickAt maps a screen position to a nick of the nick column.
+func (m *model) nickAt(x, y int) (string, bool) {
+	if m.mode != modeChat || !m.showNickList() || x < m.nickListLeft() {
+		return "", false
+	}
+
+	row := y - m.chatBodyTop()
+	nicks := m.nickList()
+	if row < 0 || row >= m.chatVP.Height || m.nickTop+row >= len(nicks) {
+		return "", false
+	}
+
+	return nicks[m.nickTop+row], true
+}
+
+// nickListLeft is the first screen column of the nick column's names.
+func (m *model) nickListLeft() int {
+	return m.leftWidth + box.GetHorizontalBorderSize() + box.GetBorderLeftSize() +
+		m.chatVP.Width + nickColumn.GetHorizontalBorderSize() + nickColumn.GetPaddingLeft()
+}
+
+func (m *model) scrollNickList(d int) {
+	n := len(m.nickList())
+	m.nickTop = max(min(m.nickTop+d, n-m.chatVP.Height), 0)
+}
+
+// clickNick selects a nick, a click on the selected one addresses it
+// in the input.
+func (m *model) clickNick(nick string) {
+	if nick != m.nickSel {
+		m.nickSel = nick
+		return
+	}
+
+	if !strings.HasPrefix(m.chatInput.Value(), nick+": ") {
+		m.chatInput.SetValue(nick + ": " + m.chatInput.Value())
+	}
+	m.chatInput.CursorEnd()
+	m.chatInput.Focus()
+}
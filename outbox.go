@@ -0,0 +1,320 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/lrstanley/girc"
+)
+
+// outgoing is a message typed while the server was unreachable.
+type outgoing struct {
+	text string
+	at   time.Time
+}
+
+// outState is how far a message shown without an echo has got.
+type outState int
+
+const (
+	outQueued    outState = iota // waiting for the flood control
+	outPending                   // not known to have reached the server yet
+	outSent                      // the server answered after it went out
+	outUnsent                    // moved to the outbox
+	outCancelled                 // dropped by /queue clear
+)
+
+// outLine is a message shown before the server confirms it. Without
+// echo-message only traffic after it, or the answer to a lag check sent
+// after it, tells that the connection carried it. With echo-message the
+// line only stands in for the echo while the message is queued.
+type outLine struct {
+	e      *girc.Event
+	target string
+	ch     string
+	text   string    // the line without its marker
+	sent   time.Time // written to the connection, zero while queued
+	state  outState
+	echo   bool
+}
+
+func (o *outLine) render() string {
+	switch o.state {
+	case outQueued:
+		return styleDarkPink.Render(o.text) + " " + styleDim.Render("(queued)")
+	case outCancelled:
+		return styleDim.Render(o.text + " (cancelled)")
+	case outPending:
+		return styleDarkPink.Render(o.text) + " " + styleDim.Render("(pending)")
+	case outUnsent:
+		return styleDim.Render(o.text+" ") + stylePinkB.Render("(unsent)")
+	}
+
+	return styleDarkPink.Render(o.text)
+}
+
+// sendMessage sends text to target, or queues it when the server is not
+// connected. The line shows as queued while the flood control holds it,
+// then without echo-message as pending until the server confirms the
+// connection.
+func (m *model) sendMessage(s *serverEntry, target, text string) {
+	if s.client == nil || !s.connected {
+		m.queueMessage(s, target, text)
+		return
+	}
+
+	e := &girc.Event{Command: girc.PRIVMSG, Params: []string{target, text}}
+	sent := m.sendLine(s, e)
+	echo := echoConfirmed(s.client)
+	if echo && sent {
+		return // the server echoes it back with its own timestamp
+	}
+
+	now := time.Now()
+	o := &outLine{e: e, target: target, ch: m.outgoingBuffer(s, target), text: outgoingText(s, target, text, now), echo: echo}
+	s.outLines = append(s.outLines, o)
+	s.channelLogs[o.ch] = append(s.channelLogs[o.ch], chatLine{at: now, text: o.render(), out: o})
+	if m.logger != nil && !echo {
+		m.logger.write(s.name, o.ch, styleDarkPink.Render(o.text), now)
+	}
+	if sent {
+		m.lineSent(s, e)
+	}
+
+	if m.mode == modeChat && m.activeID == s.id && m.activeChan == o.ch {
+		m.refreshChat()
+	}
+}
+
+// lineSent notes that e left the flood control, a lag check after it and
+// any traffic from now on confirm it. A stand-in for an echo goes.
+func (m *model) lineSent(s *serverEntry, e *girc.Event) {
+	for i, o := range s.outLines {
+		if o.e != e || !o.sent.IsZero() {
+			continue
+		}
+
+		if o.echo {
+			s.outLines = append(s.outLines[:i], s.outLines[i+1:]...)
+			m.removeOutLine(s, o)
+			return
+		}
+
+		o.sent, o.state = time.Now(), outPending
+		m.redrawOutLine(s, o)
+		s.taps.awaitTraffic()
+		s.health.ping(s)
+		return
+	}
+}
+
+// cancelOutLines marks the lines of messages dropped from the queue.
+func (m *model) cancelOutLines(s *serverEntry, events []*girc.Event) {
+	for _, e := range events {
+		for i, o := range s.outLines {
+			if o.e == e {
+				s.outLines = append(s.outLines[:i], s.outLines[i+1:]...)
+				o.state = outCancelled
+				m.redrawOutLine(s, o)
+				break
+			}
+		}
+	}
+}
+
+// confirmSent drops the pending marker of the lines written before at.
+func (m *model) confirmSent(s *serverEntry, at time.Time) {
+	kept := s.outLines[:0]
+	for _, o := range s.outLines {
+		if o.sent.IsZero() || o.sent.After(at) {
+			kept = append(kept, o)
+			continue
+		}
+
+		o.state = outSent
+		m.redrawOutLine(s, o)
+	}
+	clear(s.outLines[len(kept):])
+	s.outLines = kept
+}
+
+// redrawOutLine renders the line of o again with its new marker.
+func (m *model) redrawOutLine(s *serverEntry, o *outLine) {
+	logs := s.channelLogs[o.ch]
+	for i := len(logs) - 1; i >= 0; i-- {
+		if logs[i].out == o {
+			logs[i].text = o.render()
+			break
+		}
+	}
+
+	if m.mode == modeChat && m.activeID == s.id && m.activeChan == o.ch {
+		m.refreshChatKeepOffset()
+	}
+}
+
+// removeOutLine takes the line of o out of its buffer.
+func (m *model) removeOutLine(s *serverEntry, o *outLine) {
+	logs := s.channelLogs[o.ch]
+	for i := len(logs) - 1; i >= 0; i-- {
+		if logs[i].out == o {
+			s.channelLogs[o.ch] = append(logs[:i:i], logs[i+1:]...) // a copy, the view still holds logs
+			break
+		}
+	}
+
+	if m.mode == modeChat && m.activeID == s.id && m.activeChan == o.ch {
+		m.refreshChatKeepOffset()
+	}
+}
+
+// unconfirmed takes the shown line of e off the pending list and moves it
+// to the outbox.
+func (m *model) unconfirmed(s *serverEntry, e *girc.Event) {
+	for i, o := range s.outLines {
+		if o.e != e {
+			continue
+		}
+
+		s.outLines = append(s.outLines[:i], s.outLines[i+1:]...)
+		o.state = outUnsent
+		m.redrawOutLine(s, o)
+		m.addOutgoing(s, o.target, o.e.Last())
+		return
+	}
+}
+
+// outgoingBuffer is where a message to target shows,
+// like the echo of it would.
+func (m *model) outgoingBuffer(s *serverEntry, target string) string {
+	ch, _ := s.support.route(target)
+	return s.buffer(ch)
+}
+
+func outgoingText(s *serverEntry, target, text string, at time.Time) string {
+	if !s.support.isChannel(target) {
+		return fmt.Sprintf("[%s] [to %s] %s", stamp(at), target, text)
+	}
+
+	return fmt.Sprintf("[%s] <%s> %s", stamp(at), s.me(), text)
+}
+
+func (m *model) queueMessage(s *serverEntry, target, text string) {
+	target = m.addOutgoing(s, target, text)
+	ch := m.outgoingBuffer(s, target)
+	now := time.Now()
+	line := styleDim.Render(outgoingText(s, target, text, now)+" ") + stylePinkB.Render("(unsent)")
+	s.channelLogs[ch] = append(s.channelLogs[ch], chatLine{at: now, text: line})
+	if m.mode == modeChat && m.activeID == s.id && m.activeChan == ch {
+		m.refreshChat()
+	}
+}
+
+// addOutgoing puts a message in the outbox, it returns the outbox target.
+func (m *model) addOutgoing(s *serverEntry, target, text string) string {
+	if s.support.isChannel(target) {
+		target = s.buffer(target)
+	}
+
+	if s.outboxTotal() == 0 {
+		m.pushSysLine(s.id, m.outgoingBuffer(s, target), "-- not connected, messages are kept until the next connect --")
+	}
+
+	if s.outbox == nil {
+		s.outbox = map[string][]outgoing{}
+	}
+
+	s.outbox[target] = append(s.outbox[target], outgoing{text: text, at: time.Now()})
+	return target
+}
+
+func (s *serverEntry) outboxTotal() int {
+	n := 0
+	for _, msgs := range s.outbox {
+		n += len(msgs)
+	}
+
+	return n
+}
+
+// outboxOfferMsg asks about the outbox of a server again,
+// another dialog was open the first time.
+type outboxOfferMsg serverID
+
+// offerOutbox asks after a connect whether to send what was queued.
+func (m *model) offerOutbox(s *serverEntry) tea.Cmd {
+	if s.outboxTotal() == 0 || s.outboxSend || !s.connected {
+		return nil
+	}
+
+	if m.confirm != nil || m.unlock != nil {
+		return tea.Tick(time.Second, func(time.Time) tea.Msg { return outboxOfferMsg(s.id) })
+	}
+
+	targets := make([]string, 0, len(s.outbox))
+	for target, msgs := range s.outbox {
+		targets = append(targets, fmt.Sprintf("%s %d", target, len(msgs)))
+	}
+	sort.Strings(targets)
+
+	id := s.id
+	prompt := fmt.Sprintf("Deliver %s typed while %s was disconnected?\n(%s)",
+		plural(s.outboxTotal(), "unsent message"), s.name, strings.Join(targets, ", "))
+	m.openConfirm("Unsent messages", prompt, func(m *model) tea.Cmd {
+		if s, ok := m.servers[id]; ok {
+			s.outboxSend = true
+			m.flushOutbox(s)
+		}
+		return nil
+	})
+	m.confirm.no = func(m *model) tea.Cmd {
+		if s, ok := m.servers[id]; ok {
+			m.discardOutbox(s)
+		}
+		return nil
+	}
+	return nil
+}
+
+// flushOutbox delivers the approved queue, channels only once
+// they are joined again.
+func (m *model) flushOutbox(s *serverEntry) {
+	if !s.outboxSend || s.client == nil || !s.connected {
+		return
+	}
+
+	for target, msgs := range s.outbox {
+		if s.support.isChannel(target) && !s.joined[target] {
+			continue
+		}
+
+		ch := m.outgoingBuffer(s, target)
+		m.pushSysLine(s.id, ch, "-- delivering "+plural(len(msgs), "queued message")+" to "+target+" --")
+		for _, o := range msgs {
+			m.sendMessage(s, target, o.text)
+		}
+		delete(s.outbox, target)
+	}
+
+	if len(s.outbox) == 0 {
+		s.outboxSend = false
+	}
+
+	if m.mode == modeChat && m.activeID == s.id {
+		m.refreshChat()
+	}
+}
+
+func (m *model) discardOutbox(s *serverEntry) {
+	for target, msgs := range s.outbox {
+		m.pushSysLine(s.id, m.outgoingBuffer(s, target), "-- discarded "+plural(len(msgs), "unsent message")+" to "+target+" --")
+	}
+
+	s.outbox, s.outboxSend = nil, false
+	if m.mode == modeChat && m.activeID == s.id {
+		m.refreshChat()
+	}
+}
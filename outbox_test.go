@@ -0,0 +1,125 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/x/ansi"
+	"github.com/lrstanley/girc"
+)
+
+// pendingTestModel sends without flood control over a client that drops
+// what it is given, nothing answers unless the test says so.
+func pendingTestModel(t *testing.T) (model, *serverEntry) {
+	t.Helper()
+	m := newTestModel(t, "#a")
+	m.activeID, m.activeChan = 1, "#a"
+	m.cfg.Flood = floodConfig{Disabled: true}
+	s := m.servers[1]
+	s.client = girc.New(girc.Config{Server: "test", Nick: "me", User: "me"})
+	s.connected = true
+	return m, s
+}
+
+func markers(s *serverEntry, ch string) []string {
+	var got []string
+	for _, ln := range s.channelLogs[ch] {
+		text := ansi.Strip(ln.text)
+		marker := ""
+		if i := strings.LastIndex(text, " ("); i >= 0 && strings.HasSuffix(text, ")") {
+			marker = text[i+1:]
+		}
+		got = append(got, marker)
+	}
+
+	return got
+}
+
+func TestPendingConfirmedByTraffic(t *testing.T) {
+	m, s := pendingTestModel(t)
+	m.sendMessage(s, "#a", "hello")
+	if got := markers(s, "#a"); len(got) != 1 || got[0] != "(pending)" {
+		t.Fatalf("markers %q", got)
+	}
+
+	next, _ := m.Update(linkMsg{id: 1, at: time.Now()})
+	m = next.(model)
+	if got := markers(s, "#a"); got[0] != "" {
+		t.Errorf("still %q after traffic", got)
+	}
+	if len(s.outLines) != 0 {
+		t.Errorf("%d lines left pending", len(s.outLines))
+	}
+}
+
+func TestPendingConfirmedByLag(t *testing.T) {
+	m, s := pendingTestModel(t)
+	m.sendMessage(s, "#a", "before the check")
+	token := s.health.token
+	if token == "" {
+		t.Fatal("no lag check after the message")
+	}
+	time.Sleep(time.Millisecond)
+	m.sendMessage(s, "#a", "after the check")
+
+	m.applyLag(lagMsg{id: 1, token: token, at: time.Now()})
+	if got := markers(s, "#a"); len(got) != 2 || got[0] != "" || got[1] != "(pending)" {
+		t.Errorf("markers %q, the PONG only confirms what went before its PING", got)
+	}
+}
+
+func TestPendingMovedToOutbox(t *testing.T) {
+	m, s := pendingTestModel(t)
+	m.sendMessage(s, "#a", "one")
+	m.sendMessage(s, "bob", "two")
+
+	s.connected = false
+	m.requeueMessages(s)
+	if got := markers(s, "#a"); got[0] != "(unsent)" {
+		t.Errorf("#a markers %q", got)
+	}
+	if len(s.outbox["#a"]) != 1 || s.outbox["#a"][0].text != "one" || len(s.outbox["bob"]) != 1 {
+		t.Errorf("outbox %+v", s.outbox)
+	}
+	if len(s.outLines) != 0 {
+		t.Errorf("%d lines left pending", len(s.outLines))
+	}
+
+	// a confirmation arriving late changes nothing
+	m.confirmSent(s, time.Now())
+	if got := markers(s, "#a"); got[0] != "(unsent)" {
+		t.Errorf("#a markers %q", got)
+	}
+}
+
+func TestQueuedMarker(t *testing.T) {
+	m, s := pendingTestModel(t)
+
+	// an empty bucket holds the lines in the queue
+	m.cfg.Flood = floodConfig{IntervalMs: 60_000}
+	s.queue.filled, s.queue.tokens = time.Now(), 0
+	defer s.queue.cancel()
+
+	m.sendMessage(s, "#a", "one")
+	m.sendMessage(s, "#a", "two")
+	if got := markers(s, "#a"); strings.Join(got, ",") != "(queued),(queued)" {
+		t.Fatalf("markers %q", got)
+	}
+
+	// the first goes out, the second is cancelled
+	s.queue.mu.Lock()
+	first := s.queue.pending[0].e
+	s.queue.pending = s.queue.pending[1:]
+	s.queue.mu.Unlock()
+	next, _ := m.Update(sendQueueMsg{id: 1, e: first})
+	m = next.(model)
+	m.queueCmd(s, "clear")
+
+	if got := markers(s, "#a"); strings.Join(got, ",") != "(pending),(cancelled)" {
+		t.Errorf("markers %q", got)
+	}
+	if len(s.outLines) != 1 || s.outLines[0].e != first {
+		t.Errorf("pending %+v", s.outLines)
+	}
+}
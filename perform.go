@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/lrstanley/girc"
+)
+
+const maxPerformWait = time.Minute
+
+// performMsg starts the perform list of a server once it is registered.
+type performMsg serverID
+
+// performLineMsg runs one perform line.
+type performLineMsg struct {
+	id   serverID
+	line string
+}
+
+// performDoneMsg joins the channels after the perform list.
+type performDoneMsg serverID
+
+// parseWait reads "/wait 2s", the delay between perform lines.
+func parseWait(line string) (time.Duration, bool, error) {
+	rest, ok := strings.CutPrefix(line, "/wait")
+	if !ok || (rest != "" && rest[0] != ' ') {
+		return 0, false, nil
+	}
+
+	d, err := time.ParseDuration(strings.TrimSpace(rest))
+	if err != nil || d <= 0 || d > maxPerformWait {
+		return 0, true, fmt.Errorf("/wait takes a duration up to %s", maxPerformWait)
+	}
+
+	return d, true, nil
+}
+
+// runPerform runs the perform lines of a server in order, then joins
+// its channels if join is set. Slash lines go through the command
+// handler, anything else is sent raw.
+func (m *model) runPerform(id serverID, join bool) tea.Cmd {
+	s, ok := m.servers[id]
+	if !ok {
+		return nil
+	}
+
+	var cmds []tea.Cmd
+	for _, line := range s.perform {
+		if d, ok, err := parseWait(line); ok {
+			if err == nil {
+				cmds = append(cmds, func() tea.Msg { time.Sleep(d); return nil })
+			}
+			continue
+		}
+
+		cmds = append(cmds, func() tea.Msg { return performLineMsg{id: id, line: line} })
+	}
+
+	if len(cmds) > 0 {
+		m.pushSysLine(id, "_sys", "-- perform: "+plural(len(s.perform), "line")+" --")
+	}
+
+	if join {
+		cmds = append(cmds, func() tea.Msg { return performDoneMsg(id) })
+	}
+	return tea.Sequence(cmds...)
+}
+
+func (m *model) applyPerformLine(msg performLineMsg) tea.Cmd {
+	s, ok := m.servers[msg.id]
+	if !ok || s.client == nil {
+		return nil
+	}
+
+	line, err := m.secrets.expand(strings.ReplaceAll(msg.line, "$me", s.me()))
+	if err != nil {
+		m.pushSysLine(s.id, "_sys", "perform: "+err.Error())
+		return nil
+	}
+
+	// run it from the server buffer, its output and errors land there
+	// and not in whatever buffer is open. What a line with a secret
+	// sends stays out of the raw console and /queue.
+	sys := *m
+	sys.activeID, sys.activeChan = s.id, "_sys"
+	sys.sensitive = isSecretRef(msg.line)
+
+	// keep expanded secrets out of the buffer, "/msg NickServ IDENTIFY ${secret:ns}"
+	if target, text, ok := strings.Cut(strings.TrimPrefix(line, "/msg "), " "); ok &&
+		sys.sensitive && strings.HasPrefix(line, "/msg ") {
+		sys.sendLine(s, &girc.Event{Command: girc.PRIVMSG, Params: []string{target, text}})
+		return nil
+	}
+
+	if strings.HasPrefix(line, "/") {
+		return sys.handleSlash(s, line)
+	}
+
+	if err := sys.sendRawLine(s, line); err != nil {
+		log.Println("perform:", err)
+		m.pushSysLine(s.id, "_sys", "perform: "+err.Error())
+	}
+	return nil
+}
+
+func (m *model) joinChannels(id serverID) {
+	s, ok := m.servers[id]
+	if !ok || s.client == nil {
+		return
+	}
+
+	for _, ch := range s.channels {
+		m.joinChannel(s, ch)
+	}
+}
+
+// performCmd implements /perform [add|insert|del|clear|run].
+func (m *model) performCmd(s *serverEntry, arg string) ([]string, tea.Cmd) {
+	sub, rest, _ := strings.Cut(strings.TrimSpace(arg), " ")
+	rest = strings.TrimSpace(rest)
+	index := func(s string, n int) (int, bool) {
+		i, err := strconv.Atoi(s)
+		return i - 1, err == nil && i >= 1 && i <= n
+	}
+
+	switch strings.ToLower(sub) {
+	case "":
+		if len(s.perform) == 0 {
+			return []string{"-- no perform lines on " + s.name + " --"}, nil
+		}
+
+		out := []string{"-- perform on " + s.name + " --"}
+		for i, l := range s.perform {
+			out = append(out, fmt.Sprintf("%d. %s", i+1, l))
+		}
+		return out, nil
+	case "add":
+		if rest == "" {
+			return []string{"usage: /perform add <line>"}, nil
+		}
+
+		if _, ok, err := parseWait(rest); ok && err != nil {
+			return []string{err.Error()}, nil
+		}
+
+		s.perform = append(s.perform, rest)
+	case "insert":
+		n, line, _ := strings.Cut(rest, " ")
+		i, ok := index(n, len(s.perform)+1)
+		if !ok || strings.TrimSpace(line) == "" {
+			return []string{"usage: /perform insert <n> <line>"}, nil
+		}
+
+		s.perform = append(s.perform[:i], append([]string{strings.TrimSpace(line)}, s.perform[i:]...)...)
+	case "del":
+		i, ok := index(rest, len(s.perform))
+		if !ok {
+			return []string{"usage: /perform del <n>"}, nil
+		}
+
+		s.perform = append(s.perform[:i], s.perform[i+1:]...)
+	case "clear":
+		s.perform = nil
+	case "run":
+		if s.client == nil || !s.connected {
+			return []string{"not connected"}, nil
+		}
+
+		return nil, m.runPerform(s.id, false)
+	default:
+		return []string{"usage: /perform [add <line>|insert <n> <line>|del <n>|clear|run]"}, nil
+	}
+
+	m.saveServers()
+	return []string{"-- perform updated, " + plural(len(s.perform), "line") + " --"}, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lrstanley/girc"
+)
+
+func TestPerformOutputGoesToServerBuffer(t *testing.T) {
+	m := newTestModel(t, "#a")
+	m.activeID, m.activeChan = 1, "#a"
+	s := m.servers[1]
+	s.client = girc.New(girc.Config{Server: "test", Nick: "me", User: "me"})
+
+	m.applyPerformLine(performLineMsg{id: 1, line: "/frobnicate"})
+	m.applyPerformLine(performLineMsg{id: 1, line: "/msg NickServ IDENTIFY ${secret:ns}"})
+
+	for _, ln := range s.channelLogs["#a"] {
+		t.Errorf("perform wrote to the open channel: %q", ln.text)
+	}
+
+	var sys []string
+	for _, ln := range s.channelLogs["_sys"] {
+		sys = append(sys, ln.text)
+	}
+	got := strings.Join(sys, "\n")
+	if !strings.Contains(got, "unknown command: frobnicate") || !strings.Contains(got, "perform: ") {
+		t.Errorf("server buffer has %q", got)
+	}
+}
+
+func TestPerformSecretsAreSensitive(t *testing.T) {
+	m := newTestModel(t)
+	s := m.servers[1]
+	s.client = girc.New(girc.Config{Server: "test", Nick: "me", User: "me"})
+	s.connected = true
+	m.secrets = &secretStore{path: filepath.Join(t.TempDir(), secretsFile)}
+	if err := m.secrets.unlock("passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	m.secrets.set("ns", "hunter2")
+
+	// an empty bucket holds the lines in the queue
+	m.cfg.Flood = floodConfig{IntervalMs: 60_000}
+	s.queue.filled, s.queue.tokens = time.Now(), 0
+	defer s.queue.cancel()
+
+	for _, ln := range []string{
+		"PRIVMSG NickServ :IDENTIFY ${secret:ns}",
+		"/quote PASS ${secret:ns}",
+		"/msg NickServ IDENTIFY ${secret:ns}",
+		"PRIVMSG #a :hello",
+	} {
+		m.applyPerformLine(performLineMsg{id: 1, line: ln})
+	}
+
+	s.queue.mu.Lock()
+	pending := append([]queuedLine(nil), s.queue.pending...)
+	s.queue.mu.Unlock()
+	if len(pending) != 4 {
+		t.Fatalf("%d lines queued, want 4", len(pending))
+	}
+	for i, ln := range pending {
+		if want := i < 3; ln.e.Sensitive != want {
+			t.Errorf("%q: sensitive %v, want %v", ln.e.String(), ln.e.Sensitive, want)
+		}
+	}
+
+	for _, ln := range m.queueCmd(s, "") {
+		if strings.Contains(ln, "hunter2") {
+			t.Errorf("/queue shows %q", ln)
+		}
+	}
+	for _, ln := range s.channelLogs["_sys"] {
+		if strings.Contains(ln.text, "hunter2") {
+			t.Errorf("buffer shows %q", ln.text)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	presenceJoin presenceKind = iota
+	presencePart
+	presenceQuit
+)
+
+const (
+	defaultActiveWindow = 10 * time.Minute
+	netjoinWindow       = 30 * time.Minute
+	foldWindow          = 2 * time.Minute // events further apart start a new line
+	maxRunNames         = 4               // names listed per kind before switching to a count
+)
+
+// "irc.a.net irc.b.net" is what a netsplit QUIT looks like
+var netsplitRe = regexp.MustCompile(`^([\w-]+\.[\w.-]+) ([\w-]+\.[\w.-]+)$`)
+
+type presenceKind int
+
+// presenceMsg is a JOIN, PART or QUIT of someone on the network.
+type presenceMsg struct {
+	id      serverID
+	kind    presenceKind
+	nick    string
+	source  string // nick!user@host
+	channel string // empty for QUIT
+	reason  string
+	batch   string // IRCv3 batch type, e.g. netsplit or netjoin
+	at      time.Time
+}
+
+type presenceConfig struct {
+	ShowAll       bool `json:"show_all,omitempty"`       // disable the smart filter
+	ActiveMinutes int  `json:"active_minutes,omitempty"` // how long a nick counts as recently active
+	NoFold        bool `json:"no_fold,omitempty"`        // one line per event
+}
+
+// presenceRun is a folded run of consecutive presence events
+// shown as a single line of a buffer.
+type presenceRun struct {
+	at       time.Time
+	last     time.Time // latest event of the run
+	joined   []string
+	left     []string
+	quit     []string
+	netsplit string // "a.net ↔ b.net" for a split run
+	split    int
+	netjoin  int
+}
+
+func (r *presenceRun) render() string {
+	var parts []string
+	switch {
+	case r.split > 0:
+		label := "netsplit"
+		if r.netsplit != "" {
+			label += " " + r.netsplit
+		}
+
+		parts = append(parts, label+": "+plural(r.split, "user")+" quit")
+		if r.netjoin > 0 {
+			parts = append(parts, plural(r.netjoin, "user")+" returned")
+		}
+	case r.netjoin > 0:
+		parts = append(parts, "netjoin: "+plural(r.netjoin, "user")+" returned")
+	}
+
+	if s := runNames(r.joined, "joined"); s != "" {
+		parts = append(parts, "→ "+s)
+	}
+	if s := runNames(r.left, "left"); s != "" {
+		parts = append(parts, "← "+s)
+	}
+	if s := runNames(r.quit, "quit"); s != "" {
+		parts = append(parts, "⇐ "+s)
+	}
+
+	return styleDim.Render(fmt.Sprintf("[%s] %s", stamp(r.at), strings.Join(parts, " · ")))
+}
+
+func runNames(nicks []string, verb string) string {
+	switch {
+	case len(nicks) == 0:
+		return ""
+	case len(nicks) > maxRunNames:
+		return fmt.Sprintf("%d %s", len(nicks), verb)
+	default:
+		return strings.Join(nicks, ", ") + " " + verb
+	}
+}
+
+// noteActivity remembers when a nick last spoke in a channel.
+func (s *serverEntry) noteActivity(ch, nick string, at time.Time) {
+	if nick == "" {
+		return
+	}
+
+	if s.lastSpoke[ch] == nil {
+		s.lastSpoke[ch] = map[string]time.Time{}
+	}
+	s.lastSpoke[ch][nick] = at
+}
+
+func (s *serverEntry) recentlyActive(ch, nick string, window time.Duration, now time.Time) bool {
+	t, ok := s.lastSpoke[ch][nick]
+	return ok && now.Sub(t) <= window
+}
+
+func (s *serverEntry) addMember(ch, nick string) {
+	if s.members[ch] == nil {
+		s.members[ch] = map[string]bool{}
+	}
+	s.members[ch][nick] = true
+}
+
+// memberChannels lists the channels we share with nick.
+func (s *serverEntry) memberChannels(nick string) []string {
+	var chans []string
+	for ch, nicks := range s.members {
+		if nicks[nick] {
+			chans = append(chans, ch)
+		}
+	}
+
+	return chans
+}
+
+// applyPresence updates the roster and shows the event,
+// filtered and folded according to the presence config.
+// Channels we are joined to from elsewhere (a bouncer, a forced join)
+// get their list entry.
+func (m *model) applyPresence(p presenceMsg) tea.Cmd {
+	s, ok := m.servers[p.id]
+	if !ok {
+		return nil
+	}
+
+	if p.at.IsZero() {
+		p.at = time.Now()
+	}
+	p.channel = s.buffer(p.channel)
+
+	var chans []string
+	switch p.kind {
+	case presenceJoin:
+		chans = []string{p.channel}
+		s.addMember(p.channel, p.nick)
+	case presencePart:
+		chans = []string{p.channel}
+		if s.isMe(p.nick) {
+			delete(s.members, p.channel)
+		} else {
+			delete(s.members[p.channel], p.nick)
+		}
+	case presenceQuit:
+		chans = s.memberChannels(p.nick)
+		for _, ch := range chans {
+			delete(s.members[ch], p.nick)
+		}
+	}
+
+	// our own joins and parts are never filtered
+	if !s.isMe(p.nick) && m.ignored(s, p.source, classJoins) {
+		return nil
+	}
+
+	if s.isMe(p.nick) {
+		line := styleDim.Render(fmt.Sprintf("[%s] %s", stamp(p.at), presenceText(p)))
+		switch p.kind {
+		case presenceQuit:
+			s.joined = make(map[string]bool)
+			for _, ch := range chans {
+				delete(s.members, ch)
+				m.applyChanLine(ircChanLineMsg{id: s.id, channel: ch, line: line, at: p.at})
+			}
+			m.applyChanLine(ircChanLineMsg{id: s.id, channel: "_sys", line: line, at: p.at, mirror: len(chans) > 0})
+			return nil
+		case presencePart:
+			delete(s.joined, p.channel)
+		case presenceJoin:
+			s.joined[p.channel] = true
+		}
+
+		m.applyChanLine(ircChanLineMsg{id: s.id, channel: p.channel, line: line, at: p.at})
+		m.applyChanLine(ircChanLineMsg{id: s.id, channel: "_sys", line: line, at: p.at, mirror: true})
+		m.flushOutbox(s) // messages queued for the channel wait for the join
+		if p.kind != presenceJoin || contains(s.channels, p.channel) {
+			return nil
+		}
+
+		s.channels = append(s.channels, p.channel)
+		item := *s
+		item.channel = p.channel
+		return addListItemCmd(item)
+	}
+
+	split := p.batch == "netsplit" || (p.kind == presenceQuit && netsplitRe.MatchString(p.reason))
+	netjoin := p.batch == "netjoin"
+	if p.kind == presenceQuit && split {
+		s.splitNicks[p.nick] = p.at
+	}
+
+	if p.kind == presenceJoin {
+		if t, ok := s.splitNicks[p.nick]; ok && p.at.Sub(t) <= netjoinWindow {
+			netjoin = true
+		}
+		delete(s.splitNicks, p.nick)
+	}
+
+	window := defaultActiveWindow
+	if m.presence.ActiveMinutes > 0 {
+		window = time.Duration(m.presence.ActiveMinutes) * time.Minute
+	}
+
+	for _, ch := range chans {
+		if m.logger != nil {
+			m.logger.write(s.name, ch, presenceText(p), p.at)
+		}
+
+		// splits are summarized anyway, so they are always shown
+		if !split && !netjoin && !m.presence.ShowAll && !s.recentlyActive(ch, p.nick, window, p.at) {
+			continue
+		}
+
+		m.foldPresence(s, ch, p, split, netjoin)
+	}
+
+	return nil
+}
+
+// foldPresence adds the event to the run at the end of the buffer,
+// or starts a new one.
+func (m *model) foldPresence(s *serverEntry, ch string, p presenceMsg, split, netjoin bool) {
+	logs := s.channelLogs[ch]
+	var run *presenceRun
+	if n := len(logs); n > 0 && !m.presence.NoFold {
+		run = logs[n-1].run
+	}
+
+	// netsplits don't mix with ordinary joins and parts
+	isSplitRun := run != nil && (run.split > 0 || run.netjoin > 0)
+	if run != nil && isSplitRun != (split || netjoin) {
+		run = nil
+	}
+
+	if run != nil && p.at.Sub(run.last) > foldWindow {
+		run = nil
+	}
+
+	fresh := run == nil
+	if fresh {
+		run = &presenceRun{at: p.at}
+	}
+	run.last = p.at
+
+	switch {
+	case split:
+		if sm := netsplitRe.FindStringSubmatch(p.reason); sm != nil && run.netsplit == "" {
+			run.netsplit = sm[1] + " ↔ " + sm[2]
+		}
+		run.split++
+	case netjoin:
+		run.netjoin++
+	case p.kind == presenceJoin:
+		run.joined = append(run.joined, p.nick)
+	case p.kind == presencePart:
+		run.left = append(run.left, p.nick)
+	case p.kind == presenceQuit:
+		run.quit = append(run.quit, p.nick)
+	}
+
+	if fresh {
+		s.channelLogs[ch] = append(logs, chatLine{at: p.at, text: run.render(), run: run})
+	} else {
+		logs[len(logs)-1].text = run.render()
+	}
+
+	if m.mode == modeChat && m.activeID == s.id && m.activeChan == ch {
+		m.refreshChat()
+	}
+}
+
+func presenceText(p presenceMsg) string {
+	switch p.kind {
+	case presenceJoin:
+		return fmt.Sprintf("* %s joined %s", p.nick, p.channel)
+	case presencePart:
+		if p.reason != "" {
+			return fmt.Sprintf("* %s left %s (%s)", p.nick, p.channel, p.reason)
+		}
+		return fmt.Sprintf("* %s left %s", p.nick, p.channel)
+	default:
+		if p.reason == "" {
+			return fmt.Sprintf("* %s quit", p.nick)
+		}
+		return fmt.Sprintf("* %s quit (%s)", p.nick, p.reason)
+	}
+}
+
+// applyNames adds a RPL_NAMREPLY page to the roster.
+func (s *serverEntry) applyNames(ch, names string) {
+	ch = s.buffer(ch)
+	for _, n := range strings.Fields(names) {
+		n = s.support.trimPrefix(n)
+		if i := strings.IndexByte(n, '!'); i > 0 {
+			n = n[:i] // userhost-in-names
+		}
+
+		if n != "" {
+			s.addMember(ch, n)
+		}
+	}
+}
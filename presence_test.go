@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+func lastLine(s *serverEntry, ch string) string {
+	logs := s.channelLogs[ch]
+	if len(logs) == 0 {
+		return ""
+	}
+
+	return ansi.Strip(logs[len(logs)-1].text)
+}
+
+func TestOwnQuit(t *testing.T) {
+	m := newTestModel(t, "#go")
+	s := m.servers[1]
+	at := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	m.applyPresence(presenceMsg{id: 1, kind: presenceJoin, nick: "me", channel: "#go", at: at})
+	if !s.joined["#go"] {
+		t.Fatal("not joined after our JOIN")
+	}
+
+	m.applyPresence(presenceMsg{id: 1, kind: presenceQuit, nick: "me", reason: "bye", at: at})
+	if len(s.joined) != 0 {
+		t.Errorf("still joined to %v", s.joined)
+	}
+	if got := lastLine(s, "_sys"); !strings.HasSuffix(got, "* me quit (bye)") {
+		t.Errorf("_sys shows %q", got)
+	}
+	if got := lastLine(s, "#go"); !strings.HasSuffix(got, "* me quit (bye)") {
+		t.Errorf("#go shows %q", got)
+	}
+}
+
+func TestFoldWindow(t *testing.T) {
+	m := newTestModel(t, "#go")
+	m.presence.ShowAll = true
+	s := m.servers[1]
+	at := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	for _, ev := range []struct {
+		nick string
+		at   time.Time
+	}{
+		{"alice", at},
+		{"bob", at.Add(time.Minute)},
+		{"carol", at.Add(time.Minute + foldWindow + time.Second)},
+	} {
+		m.applyPresence(presenceMsg{id: 1, kind: presenceJoin, nick: ev.nick, channel: "#go", at: ev.at})
+	}
+
+	var runs []string
+	for _, l := range s.channelLogs["#go"] {
+		if l.run != nil {
+			runs = append(runs, ansi.Strip(l.text))
+		}
+	}
+
+	if len(runs) != 2 || !strings.HasSuffix(runs[0], "alice, bob joined") || !strings.HasSuffix(runs[1], "carol joined") {
+		t.Errorf("runs %q", runs)
+	}
+}
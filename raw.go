@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	rawBuffer   = "_raw"
+	rawMaxLines = 2000 // the console keeps the newest lines only
+	rawBacklog  = 512  // lines waiting for the UI before the tap drops them
+	rawStamp    = "15:04:05.000"
+)
+
+// rawLineMsg is one line of the protocol, sent or received.
+type rawLineMsg struct {
+	id   serverID
+	out  bool
+	line string
+	at   time.Time
+}
+
+// rawTap forwards the lines of a connection to its console, it is on the
+// connection taps only while the console is on. Lines are queued, girc's
+// loops must not wait on a busy UI that may itself be waiting to send.
+type rawTap struct {
+	id    serverID
+	lines chan rawLineMsg
+}
+
+func newRawTap(id serverID) *rawTap {
+	t := &rawTap{id: id, lines: make(chan rawLineMsg, rawBacklog)}
+	go func() {
+		for msg := range t.lines {
+			program.Send(msg)
+		}
+	}()
+
+	return t
+}
+
+// line queues a line, the caller holds the taps' lock.
+func (t *rawTap) line(out bool, text string, at time.Time) {
+	select {
+	case t.lines <- rawLineMsg{id: t.id, out: out, line: text, at: at}:
+	default: // the console lags behind, skip the line
+	}
+}
+
+func (t *rawTap) close() {
+	close(t.lines)
+}
+
+func (m *model) applyRawLine(msg rawLineMsg) {
+	s, ok := m.servers[msg.id]
+	if !ok || !s.taps.consoleOn() {
+		return
+	}
+
+	line := styleDim.Render(fmt.Sprintf("[%s] ← %s", msg.at.Format(rawStamp), msg.line))
+	if msg.out {
+		line = stylePink.Render(fmt.Sprintf("[%s] → %s", msg.at.Format(rawStamp), msg.line))
+	}
+
+	logs := append(s.channelLogs[rawBuffer], chatLine{at: msg.at, text: line})
+	if len(logs) > rawMaxLines {
+		logs = logs[len(logs)-rawMaxLines:]
+	}
+	s.channelLogs[rawBuffer] = logs
+
+	if m.mode == modeChat && m.activeID == s.id && m.activeChan == rawBuffer {
+		m.refreshChat()
+	}
+}
+
+// consoleMsg is /console [on|off], it switches buffers so handleSlash
+// hands it over to Update.
+type consoleMsg struct {
+	id  serverID
+	arg string
+}
+
+// consoleCmd turns the raw console of a server on or off,
+// without an argument it toggles.
+func (m *model) consoleCmd(msg consoleMsg) []string {
+	s, ok := m.servers[msg.id]
+	if !ok {
+		return nil
+	}
+
+	on := !s.taps.consoleOn()
+	switch strings.ToLower(strings.TrimSpace(msg.arg)) {
+	case "on":
+		on = true
+	case "off":
+		on = false
+	case "":
+	default:
+		return []string{"usage: /console [on|off]"}
+	}
+
+	s.taps.setConsole(s.id, on)
+	if !on {
+		delete(s.channelLogs, rawBuffer)
+		if m.activeChan == rawBuffer {
+			m.activeChan = "_sys"
+		}
+
+		return []string{"-- raw console off --"}
+	}
+
+	m.activeChan = rawBuffer
+	m.pushSysLine(s.id, rawBuffer, "-- raw console on, lines typed here are sent as they are, /console off stops it --")
+	return nil
+}
+
+// quoteCmd implements /quote and /raw, the line goes out unchanged.
+func (m *model) quoteCmd(s *serverEntry, line string) string {
+	if line = strings.TrimSpace(line); line == "" {
+		return "usage: /quote <raw IRC line>"
+	}
+
+	if s.client == nil || !s.connected {
+		return "not connected"
+	}
+
+	if err := m.sendRawLine(s, line); err != nil {
+		return "quote: " + err.Error()
+	}
+
+	return ""
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lrstanley/girc"
+)
+
+const (
+	recordHeader     = "# clirc recording"
+	recordTimeFormat = time.RFC3339Nano
+	replayEndToken   = "clirc-replay-end"
+)
+
+// recordedLine is one line read from the server and when it arrived.
+type recordedLine struct {
+	at  time.Time
+	raw string // the bytes as read, terminator included
+}
+
+// replaySource is a recording loaded by "clirc replay".
+type replaySource struct {
+	name    string
+	address string
+	nick    string
+	lines   []recordedLine
+	speed   float64 // 0 replays without pauses
+}
+
+// recordSession writes everything the server sends to a new file in dir,
+// <server>-<time>.rec, until the connection ends. Each line is stored as
+// it was read, "<time> <length> <bytes>\n", terminator included.
+func recordSession(c *girc.Client, s *serverEntry, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, safeFileName(s.name)+"-"+time.Now().Format("20060102-150405")+".rec")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := fmt.Fprintf(f, "%s %s %s %s\n", recordHeader, s.address, s.nick, s.name); err != nil {
+		f.Close()
+		return "", err
+	}
+
+	s.taps.record(f)
+	c.Handlers.Add(girc.DISCONNECTED, func(_ *girc.Client, _ girc.Event) {
+		s.taps.stopRecording(f)
+	})
+
+	return path, nil
+}
+
+// record makes f the recording, in place of an earlier one.
+func (t *connTaps) record(f *os.File) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.rec != nil {
+		t.rec.Close()
+	}
+	t.rec = f
+}
+
+// stopRecording closes f, unless a newer connection records already.
+func (t *connTaps) stopRecording(f *os.File) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.rec == f {
+		t.rec.Close()
+		t.rec = nil
+	}
+}
+
+// recordLine stores a line read from the server, the caller holds mu.
+func (t *connTaps) recordLine(line []byte, at time.Time) {
+	if _, err := fmt.Fprintf(t.rec, "%s %d %s\n", at.Format(recordTimeFormat), len(line), line); err != nil {
+		log.Println("record:", err)
+		t.rec.Close()
+		t.rec = nil
+	}
+}
+
+// loadRecording reads a file written by recordSession.
+func loadRecording(path string) (*replaySource, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	head, err := r.ReadString('\n')
+	if !strings.HasPrefix(head, recordHeader) {
+		return nil, errors.New("not a clirc recording")
+	} else if err != nil {
+		return nil, err
+	}
+
+	// "<address> <nick> <server name>"
+	fields := strings.SplitN(strings.TrimSpace(strings.TrimPrefix(head, recordHeader)), " ", 3)
+	if len(fields) < 3 {
+		return nil, errors.New("bad recording header")
+	}
+
+	src := &replaySource{address: fields[0], nick: fields[1], name: fields[2]}
+	for n := 1; ; n++ {
+		ln, err := readRecordedLine(r)
+		if errors.Is(err, io.EOF) {
+			return src, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", n, err)
+		}
+
+		src.lines = append(src.lines, ln)
+	}
+}
+
+// readRecordedLine reads one "<time> <length> <bytes>\n" entry, io.EOF
+// at the end of the file.
+func readRecordedLine(r *bufio.Reader) (recordedLine, error) {
+	ts, err := r.ReadString(' ')
+	if err == io.EOF && ts == "" {
+		return recordedLine{}, io.EOF
+	} else if err != nil {
+		return recordedLine{}, io.ErrUnexpectedEOF
+	}
+
+	at, err := time.Parse(recordTimeFormat, strings.TrimSuffix(ts, " "))
+	if err != nil {
+		return recordedLine{}, err
+	}
+
+	size, err := r.ReadString(' ')
+	if err != nil {
+		return recordedLine{}, io.ErrUnexpectedEOF
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(size, " "))
+	if err != nil || n <= 0 || n > tapMaxLine {
+		return recordedLine{}, fmt.Errorf("bad length %q", strings.TrimSuffix(size, " "))
+	}
+
+	raw := make([]byte, n+1)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return recordedLine{}, io.ErrUnexpectedEOF
+	}
+	if raw[n] != '\n' {
+		return recordedLine{}, errors.New("entry longer than its length")
+	}
+
+	return recordedLine{at: at, raw: string(raw[:n])}, nil
+}
+
+// parseReplayArgs reads "clirc replay [-speed n] <file>".
+func parseReplayArgs(args []string) (*replaySource, error) {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	speed := fs.Float64("speed", 1, "playback speed, 0 for no pauses")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: clirc replay [-speed n] <file>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if fs.NArg() != 1 || *speed < 0 {
+		fs.Usage()
+		return nil, errors.New("one recording and a speed of at least 0 expected")
+	}
+
+	src, err := loadRecording(fs.Arg(0))
+	if err != nil {
+		return nil, err
+	}
+
+	src.speed = *speed
+	return src, nil
+}
+
+// startReplay adds the server of a recording, it "connects" through
+// replaySession once the program runs.
+func (m *model) startReplay(src *replaySource) {
+	m.unlock = nil // nothing to log in with
+
+	id := m.nextID
+	m.nextID++
+	s := newServerEntry(id, formCfg{Name: src.name + " (replay)", Address: src.address, Nick: src.nick})
+	s.replay = src
+	m.servers[id] = s
+	m.serverList.SetItems(append(s.listItems(), addServerItem{}))
+	m.mode, m.activeID, m.activeChan = modeChat, id, "_sys"
+	m.focus = paneRight
+	m.focusRight()
+}
+
+// replaySession connects c to the recording instead of a server. What the
+// client sends is read and dropped, the recorded lines are played back with
+// their original pauses divided by the speed. A final PING tells when the
+// client has handled all of them.
+func replaySession(c *girc.Client, s *serverEntry) error {
+	id, src := s.id, s.replay
+	client, server := net.Pipe()
+	go func() {
+		sc := bufio.NewScanner(server)
+		for sc.Scan() {
+			if strings.HasPrefix(sc.Text(), "PONG") && strings.Contains(sc.Text(), replayEndToken) {
+				program.Send(ircChanLineMsg{id: id, channel: "_sys", line: styleDim.Render(fmt.Sprintf("-- end of recording, %s replayed --", plural(len(src.lines), "line")))})
+			}
+		}
+	}()
+	go func() {
+		var prev time.Time
+		for _, ln := range src.lines {
+			if src.speed > 0 && !prev.IsZero() {
+				time.Sleep(time.Duration(float64(ln.at.Sub(prev)) / src.speed))
+			}
+			prev = ln.at
+
+			if _, err := io.WriteString(server, ln.raw); err != nil {
+				return
+			}
+		}
+
+		io.WriteString(server, "PING :"+replayEndToken+"\r\n")
+	}()
+
+	return c.MockConnect(s.taps.attach(client))
+}
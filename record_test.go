@@ -0,0 +1,152 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lrstanley/girc"
+)
+
+func writeRecording(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "fake.rec")
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// TestRecordExactBytes records through the connection tap and loads the
+// file back, the lines have to come out as they were read.
+func TestRecordExactBytes(t *testing.T) {
+	s := &serverEntry{name: "fake", address: "irc.example:6697", nick: "me", taps: &connTaps{}}
+	c := girc.New(girc.Config{Server: "irc.example", Nick: "me"})
+	path, err := recordSession(c, s, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read := []string{
+		"@time=2025-01-01T10:00:00.000Z :srv NOTICE *  :two  spaces\r\n",
+		":bob!b@h PRIVMSG #a :caf\xe9 \x02bold\x02\n",
+		":srv PING :x\r\n",
+	}
+	conn := &tapConn{taps: s.taps}
+	at := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	for i, ln := range read {
+		conn.split(false, []byte(ln), at.Add(time.Duration(i)*time.Second))
+	}
+	conn.split(true, []byte("PONG :x\r\n"), at)
+	s.taps.stopRecording(s.taps.rec)
+
+	src, err := loadRecording(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src.address != "irc.example:6697" || src.nick != "me" || src.name != "fake" {
+		t.Errorf("header %+v", src)
+	}
+	if len(src.lines) != len(read) {
+		t.Fatalf("loaded %d lines, want %d", len(src.lines), len(read))
+	}
+	for i, ln := range src.lines {
+		if ln.raw != read[i] || !ln.at.Equal(at.Add(time.Duration(i)*time.Second)) {
+			t.Errorf("line %d: %q at %s", i, ln.raw, ln.at)
+		}
+	}
+}
+
+func TestLoadRecording(t *testing.T) {
+	const head = recordHeader + " irc.example:6697 me fake net\n"
+	tests := []struct {
+		name    string
+		body    string
+		want    []string
+		wantErr string
+	}{
+		{name: "empty recording", body: head},
+		{name: "lines", body: head + "2025-01-01T10:00:00Z 9 PING :x\r\n\n2025-01-01T10:00:01Z 5 a\nb\r\n\n", want: []string{"PING :x\r\n", "a\nb\r\n"}},
+		{name: "not a recording", body: "PING :x\r\n", wantErr: "not a clirc recording"},
+		{name: "bad header", body: recordHeader + " irc.example:6697\n", wantErr: "bad recording header"},
+		{name: "bad time", body: head + "yesterday 9 PING :x\r\n\n", wantErr: "entry 1"},
+		{name: "bad length", body: head + "2025-01-01T10:00:00Z x PING :x\r\n\n", wantErr: "bad length"},
+		{name: "length too short", body: head + "2025-01-01T10:00:00Z 4 PING :x\r\n\n", wantErr: "longer than its length"},
+		{name: "cut short", body: head + "2025-01-01T10:00:00Z 8 PING", wantErr: "unexpected EOF"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := loadRecording(writeRecording(t, tt.body))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if src.name != "fake net" {
+				t.Errorf("name %q", src.name)
+			}
+			var got []string
+			for _, ln := range src.lines {
+				got = append(got, ln.raw)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseReplayArgs(t *testing.T) {
+	path := writeRecording(t, recordHeader+" irc.example:6697 me fake\n")
+	tests := []struct {
+		name      string
+		args      []string
+		wantSpeed float64
+		wantErr   bool
+	}{
+		{name: "default speed", args: []string{path}, wantSpeed: 1},
+		{name: "speed", args: []string{"-speed", "10", path}, wantSpeed: 10},
+		{name: "no pauses", args: []string{"-speed=0", path}, wantSpeed: 0},
+		{name: "no file", args: nil, wantErr: true},
+		{name: "two files", args: []string{path, path}, wantErr: true},
+		{name: "negative speed", args: []string{"-speed", "-1", path}, wantErr: true},
+		{name: "bad flag", args: []string{"-fast", path}, wantErr: true},
+		{name: "missing file", args: []string{path + ".gone"}, wantErr: true},
+	}
+
+	devnull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devnull.Close()
+	stderr := os.Stderr
+	os.Stderr = devnull // the usage text
+	defer func() { os.Stderr = stderr }()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := parseReplayArgs(tt.args)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if src.speed != tt.wantSpeed || src.name != "fake" {
+				t.Errorf("speed %v, name %q", src.speed, src.name)
+			}
+		})
+	}
+}
@@ -0,0 +1,565 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+const maxSearchResults = 500
+
+var (
+	styleMatch    = lipgloss.NewStyle().Foreground(pink).Bold(true).Underline(true)
+	styleCurMatch = lipgloss.NewStyle().Foreground(lipgloss.Color("#000")).Background(pink).Bold(true)
+)
+
+type globalSearchMsg struct {
+	query string
+}
+
+type diskResultsMsg struct {
+	query   string
+	results []searchResult
+}
+
+// bufferSearch is the search bar of the chat pane.
+type bufferSearch struct {
+	input   textinput.Model
+	active  bool // bar is shown
+	editing bool // query is being typed
+	re      *regexp.Regexp
+	matches []int // log line indexes
+	cur     int
+}
+
+type searchResult struct {
+	id      serverID
+	server  string
+	channel string
+	time    string
+	text    string
+	line    int    // index in channelLogs, -1 for on-disk hits
+	path    string // log file for on-disk hits
+}
+
+func (r searchResult) Title() string {
+	ch := r.channel
+	if ch == "_sys" {
+		ch = "(system)"
+	}
+
+	t := r.time
+	if t == "" {
+		t = "--:--"
+	}
+
+	src := ""
+	if r.line < 0 {
+		src = " · log"
+	}
+
+	return fmt.Sprintf("%s · %s · %s%s", r.server, ch, t, src)
+}
+
+func (r searchResult) Description() string {
+	return r.text
+}
+
+func (r searchResult) FilterValue() string {
+	return r.text
+}
+
+func newSearchInput(prompt, placeholder string) textinput.Model {
+	ti := textinput.New()
+	ti.Prompt = stylePinkB.Render(prompt)
+	ti.TextStyle = stylePink
+	ti.Placeholder = placeholder
+	return ti
+}
+
+func newResultsList() list.Model {
+	delegate := list.NewDefaultDelegate()
+	delegate.Styles.NormalTitle = stylePink
+	delegate.Styles.NormalDesc = styleDim
+	delegate.Styles.SelectedTitle = styleDarkSel.Bold(true)
+	delegate.Styles.SelectedDesc = styleDarkSel
+
+	l := list.New(nil, delegate, 20, 10)
+	l.SetShowTitle(false)
+	l.SetShowHelp(false)
+	l.SetFilteringEnabled(false)
+	l.SetShowStatusBar(false)
+	l.KeyMap.Quit.SetEnabled(false)
+	l.KeyMap.ForceQuit.SetEnabled(false)
+	return l
+}
+
+// searchPattern compiles a case-insensitive literal matcher.
+func searchPattern(q string) *regexp.Regexp {
+	return regexp.MustCompile("(?i)" + regexp.QuoteMeta(q))
+}
+
+// openBufferSearch shows the search bar in the chat pane.
+func (m *model) openBufferSearch() tea.Cmd {
+	m.search.active = true
+	m.search.editing = true
+	m.chatInput.Blur()
+	return m.search.input.Focus()
+}
+
+func (m *model) closeBufferSearch() {
+	m.search.active = false
+	m.search.editing = false
+	m.search.re = nil
+	m.search.matches = nil
+	m.search.input.Blur()
+	m.search.input.SetValue("")
+	m.chatInput.Focus()
+	m.refreshChat()
+}
+
+func (m model) updateBufferSearch(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.search.editing {
+		switch {
+		case key.Matches(msg, m.keys.Back):
+			m.closeBufferSearch()
+			return m, nil
+		case key.Matches(msg, m.keys.Send):
+			q := strings.TrimSpace(m.search.input.Value())
+			if q == "" {
+				m.closeBufferSearch()
+				return m, nil
+			}
+
+			m.search.editing = false
+			m.search.input.Blur()
+			m.runBufferSearch(q)
+			return m, nil
+		}
+
+		var cmd tea.Cmd
+		m.search.input, cmd = m.search.input.Update(msg)
+		return m, cmd
+	}
+
+	switch {
+	case key.Matches(msg, m.keys.Back):
+		m.closeBufferSearch()
+	case key.Matches(msg, m.keys.Search):
+		m.search.editing = true
+		return m, m.search.input.Focus()
+	case key.Matches(msg, m.keys.SearchNext):
+		m.stepMatch(1)
+	case key.Matches(msg, m.keys.SearchPrev):
+		m.stepMatch(-1)
+	case key.Matches(msg, m.keys.ScrollUp):
+		m.chatVP.ScrollUp(1)
+	case key.Matches(msg, m.keys.ScrollDown):
+		m.chatVP.ScrollDown(1)
+	case key.Matches(msg, m.keys.PageUp):
+		m.chatVP.HalfPageUp()
+	case key.Matches(msg, m.keys.PageDown):
+		m.chatVP.HalfPageDown()
+	}
+
+	return m, nil
+}
+
+// runBufferSearch collects matches in the active buffer
+// and jumps to the newest one.
+func (m *model) runBufferSearch(q string) {
+	m.search.re = searchPattern(q)
+	m.search.matches = nil
+	if s := m.servers[m.activeID]; s != nil {
+		for i, ln := range s.channelLogs[m.activeChan] {
+			if m.search.re.MatchString(ansi.Strip(ln.text)) {
+				m.search.matches = append(m.search.matches, i)
+			}
+		}
+	}
+
+	m.search.cur = len(m.search.matches) - 1
+	m.refreshChat()
+}
+
+func (m *model) stepMatch(d int) {
+	n := len(m.search.matches)
+	if n == 0 {
+		return
+	}
+
+	m.search.cur = (m.search.cur + d + n) % n
+	m.refreshChat()
+}
+
+// currentMatch returns the log line index of the selected match or -1.
+func (m *model) currentMatch() int {
+	if !m.search.active || m.search.re == nil || len(m.search.matches) == 0 {
+		return -1
+	}
+
+	return m.search.matches[m.search.cur]
+}
+
+// highlightMatches marks the matches in a line and keeps its own
+// styling around them. Lines without a match are returned as is.
+func highlightMatches(line string, re *regexp.Regexp, current bool) string {
+	var locs [][]int
+	for _, loc := range re.FindAllStringIndex(ansi.Strip(line), -1) {
+		if loc[0] < loc[1] {
+			locs = append(locs, loc)
+		}
+	}
+	if len(locs) == 0 {
+		return line
+	}
+
+	hl := styleMatch
+	if current {
+		hl = styleCurMatch
+	}
+	on, _, _ := strings.Cut(hl.Render("x"), "x")
+
+	var b strings.Builder
+	var sgr strings.Builder // line styles in effect, restored after each match
+	pos, in := 0, false     // pos is the offset in the stripped line
+	for i := 0; i < len(line); {
+		if line[i] == ansi.ESC {
+			seq := line[i : i+escapeLen(line[i:])]
+			i += len(seq)
+			isSGR := strings.HasPrefix(seq, "\x1b[") && strings.HasSuffix(seq, "m")
+			switch {
+			case isSGR && (seq == ansi.ResetStyle || seq == "\x1b[0m"):
+				sgr.Reset()
+			case isSGR:
+				sgr.WriteString(seq)
+			}
+			if !in || !isSGR { // inside a match the line's styles wait until it ends
+				b.WriteString(seq)
+			}
+			continue
+		}
+
+		if !in && len(locs) > 0 && pos == locs[0][0] {
+			b.WriteString(on)
+			in = true
+		}
+		b.WriteByte(line[i])
+		i++
+		pos++
+		if in && pos == locs[0][1] {
+			b.WriteString(ansi.ResetStyle + sgr.String())
+			in, locs = false, locs[1:]
+		}
+	}
+
+	return b.String()
+}
+
+// escapeLen is the length of the escape sequence s starts with.
+func escapeLen(s string) int {
+	if len(s) < 2 {
+		return len(s)
+	}
+
+	switch s[1] {
+	case '[': // CSI, ends with a byte in @..~
+		for i := 2; i < len(s); i++ {
+			if s[i] >= 0x40 && s[i] <= 0x7e {
+				return i + 1
+			}
+		}
+	case ']': // OSC, ends with BEL or ST
+		for i := 2; i < len(s); i++ {
+			if s[i] == '\a' {
+				return i + 1
+			}
+			if s[i] == ansi.ESC && i+1 < len(s) && s[i+1] == '\\' {
+				return i + 2
+			}
+		}
+	default:
+		return 2
+	}
+
+	return len(s)
+}
+
+func (m model) viewSearchBar() string {
+	if m.search.editing {
+		return m.search.input.View()
+	}
+
+	status := "no matches"
+	if n := len(m.search.matches); n > 0 {
+		status = fmt.Sprintf("match %d/%d", m.search.cur+1, n)
+	}
+
+	return stylePinkB.Render("/"+m.search.input.Value()) + "  " + styleDim.Render(status+" · "+
+		m.keys.SearchNext.Help().Key+"/"+m.keys.SearchPrev.Help().Key+" next/prev · "+
+		m.keys.Back.Help().Key+" close")
+}
+
+// openGlobalSearch switches the right pane to the search view.
+func (m *model) openGlobalSearch(query string) tea.Cmd {
+	if m.mode != modeSearch {
+		m.prevMode = m.mode
+	}
+
+	m.blurRight()
+	m.mode = modeSearch
+	m.focus = paneRight
+	m.globalInput.SetValue(query)
+	if query == "" {
+		m.results.SetItems(nil)
+		return m.globalInput.Focus()
+	}
+
+	m.globalInput.Blur()
+	return m.runGlobalSearch(query)
+}
+
+// runGlobalSearch lists in-memory hits right away,
+// on-disk logs are scanned in the background.
+func (m *model) runGlobalSearch(query string) tea.Cmd {
+	re := searchPattern(query)
+	var results []searchResult
+	for _, s := range m.servers {
+		for ch, logs := range s.channelLogs {
+			for i, ln := range logs {
+				plain := ansi.Strip(ln.text)
+				if !re.MatchString(plain) {
+					continue
+				}
+
+				results = append(results, searchResult{
+					id:      s.id,
+					server:  s.name,
+					channel: ch,
+					time:    stamp(ln.at),
+					text:    strings.TrimSpace(plain),
+					line:    i,
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.server != b.server {
+			return a.server < b.server
+		}
+		if a.channel != b.channel {
+			return a.channel < b.channel
+		}
+		return a.line < b.line
+	})
+
+	if len(results) > maxSearchResults {
+		results = results[len(results)-maxSearchResults:]
+	}
+
+	m.setResults(results)
+	if m.logger == nil {
+		return nil
+	}
+
+	return searchLogsCmd(m.logger.dir, query)
+}
+
+func (m *model) setResults(results []searchResult) {
+	items := make([]list.Item, len(results))
+	for i, r := range results {
+		items[i] = r
+	}
+
+	m.results.SetItems(items)
+	m.results.ResetSelected()
+}
+
+func (m *model) addDiskResults(msg diskResultsMsg) {
+	if m.mode != modeSearch || m.globalInput.Value() != msg.query {
+		return // stale
+	}
+
+	// lines of this session are in memory already
+	seen := map[string]bool{}
+	for _, it := range m.results.Items() {
+		if r, ok := it.(searchResult); ok {
+			seen[r.server+"\x00"+r.channel+"\x00"+r.text] = true
+		}
+	}
+
+	items := m.results.Items()
+	for _, r := range msg.results {
+		// the buffer may go by another case than its log file
+		if s := m.serverNamed(r.server); s != nil {
+			r.id, r.server, r.channel = s.id, s.name, s.buffer(r.channel)
+		}
+
+		if seen[r.server+"\x00"+r.channel+"\x00"+strings.TrimSpace(r.text)] {
+			continue
+		}
+		items = append(items, r)
+	}
+	m.results.SetItems(items)
+}
+
+func (m model) updateGlobalSearch(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.globalInput.Focused() {
+		switch {
+		case key.Matches(msg, m.keys.Back):
+			m.closeGlobalSearch()
+			return m, nil
+		case key.Matches(msg, m.keys.Send):
+			q := strings.TrimSpace(m.globalInput.Value())
+			if q == "" {
+				return m, nil
+			}
+
+			m.globalInput.Blur()
+			return m, m.runGlobalSearch(q)
+		}
+
+		var cmd tea.Cmd
+		m.globalInput, cmd = m.globalInput.Update(msg)
+		return m, cmd
+	}
+
+	switch {
+	case key.Matches(msg, m.keys.Back):
+		m.closeGlobalSearch()
+		return m, nil
+	case key.Matches(msg, m.keys.Search, m.keys.GlobalSearch):
+		return m, m.globalInput.Focus()
+	case key.Matches(msg, m.keys.Select):
+		if r, ok := m.results.SelectedItem().(searchResult); ok {
+			return m, m.jumpToResult(r)
+		}
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.results, cmd = m.results.Update(msg)
+	return m, cmd
+}
+
+func (m *model) closeGlobalSearch() {
+	m.globalInput.Blur()
+	m.mode = m.prevMode
+	if m.mode == modeChat && m.activeID == 0 {
+		m.mode = modeForm
+	}
+	m.focusRight()
+}
+
+// jumpToResult opens the buffer of a hit with the query highlighted.
+func (m *model) jumpToResult(r searchResult) tea.Cmd {
+	s, ok := m.servers[r.id]
+	if !ok || (r.line < 0 && s.channelLogs[r.channel] == nil) {
+		m.results.NewStatusMessage("buffer not open, hit is in " + r.path)
+		return nil
+	}
+
+	m.activeID = r.id
+	m.activeChan = r.channel
+	m.mode = modeChat
+	m.focus = paneRight
+	m.globalInput.Blur()
+
+	q := m.globalInput.Value()
+	m.search.input.SetValue(q)
+	m.search.active = true
+	m.search.editing = false
+	m.runBufferSearch(q)
+	if r.line >= 0 {
+		for i, idx := range m.search.matches {
+			if idx == r.line {
+				m.search.cur = i
+				break
+			}
+		}
+	} else {
+		// on-disk hit, select the newest in-memory match of the same text
+		for i, idx := range m.search.matches {
+			if strings.Contains(ansi.Strip(s.channelLogs[r.channel][idx].text), r.text) {
+				m.search.cur = i
+			}
+		}
+	}
+
+	m.refreshChat()
+	return nil
+}
+
+func (m model) viewGlobalSearch() string {
+	var b strings.Builder
+	b.WriteString(stylePinkB.Render(" Search all buffers") + "\n\n")
+	b.WriteString(m.globalInput.View() + "\n\n")
+	if n := len(m.results.Items()); n > 0 || !m.globalInput.Focused() {
+		b.WriteString(styleDim.Render(plural(n, "result")) + "\n")
+		b.WriteString(m.results.View() + "\n")
+	}
+
+	b.WriteString(styleDim.Render("enter search/jump · " + m.keys.Back.Help().Key + " back"))
+	return b.String()
+}
+
+// searchLogsCmd scans <dir>/<server>/<channel>.log files for the query.
+func searchLogsCmd(dir, query string) tea.Cmd {
+	return func() tea.Msg {
+		re := searchPattern(query)
+		var results []searchResult
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || filepath.Ext(path) != ".log" {
+				return err
+			}
+
+			server := fileNameOf(filepath.Base(filepath.Dir(path)))
+			channel := fileNameOf(strings.TrimSuffix(d.Name(), ".log"))
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			sc := bufio.NewScanner(f)
+			for sc.Scan() {
+				ln := sc.Text()
+				if !re.MatchString(ln) {
+					continue
+				}
+
+				r := searchResult{id: -1, server: server, channel: channel, text: ln, line: -1, path: path}
+				if len(ln) > len(logTimeFormat) {
+					r.time = ln[:len(logTimeFormat)]
+					r.text = ln[len(logTimeFormat)+1:]
+				}
+				results = append(results, r)
+			}
+
+			return sc.Err()
+		})
+		if err != nil {
+			return errMsg(err)
+		}
+
+		if len(results) > maxSearchResults {
+			results = results[len(results)-maxSearchResults:]
+		}
+
+		return diskResultsMsg{query: query, results: results}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+func TestHighlightMatches(t *testing.T) {
+	const (
+		red  = "\x1b[31m"
+		bold = "\x1b[1m"
+	)
+
+	tests := []struct {
+		name, line, re string
+		want           string
+	}{
+		{"no match", red + "hello" + ansi.ResetStyle, "zz", red + "hello" + ansi.ResetStyle},
+		{"plain", "say hi", "hi", "say hi" + ansi.ResetStyle},
+		{"keeps style", red + "say hi there" + ansi.ResetStyle, "hi", red + "say hi" + ansi.ResetStyle + red + " there" + ansi.ResetStyle},
+		{"style inside match", "<" + red + "bob" + ansi.ResetStyle + "> hi", "<bo", "<bo" + ansi.ResetStyle + red + "b" + ansi.ResetStyle + "> hi"},
+		{"stacked styles", red + bold + "a hit" + ansi.ResetStyle, "hit", red + bold + "a hit" + ansi.ResetStyle + red + bold + ansi.ResetStyle},
+		{"empty matches skipped", red + "abc", "x*", red + "abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// no color profile in tests, the highlight itself renders empty
+			got := highlightMatches(tt.line, regexp.MustCompile(tt.re), false)
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if ansi.Strip(got) != ansi.Strip(tt.line) {
+				t.Errorf("text changed: %q", ansi.Strip(got))
+			}
+		})
+	}
+}
+
+func TestEscapeLen(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"\x1b[31mx", 5},
+		{"\x1b[38;2;1;2;3mx", 13},
+		{"\x1b]8;;http://x\x07y", 14},
+		{"\x1b]8;;\x1b\\y", 7},
+		{"\x1b7x", 2},
+		{"\x1b[31", 4}, // unterminated
+	}
+
+	for _, tt := range tests {
+		if got := escapeLen(tt.in); got != tt.want {
+			t.Errorf("escapeLen(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSafeFileName(t *testing.T) {
+	seen := map[string]string{}
+	for _, name := range []string{"#go", "#a/b", "#a_b", "#a%2Fb", `a\b`, "net:1", "100%", "_sys"} {
+		safe := safeFileName(name)
+		if strings.ContainsAny(safe, `/\:`) {
+			t.Errorf("%q: %q can't be a file name", name, safe)
+		}
+		if back := fileNameOf(safe); back != name {
+			t.Errorf("%q: read back as %q", name, back)
+		}
+		if other, ok := seen[safe]; ok {
+			t.Errorf("%q and %q share %q", name, other, safe)
+		}
+		seen[safe] = name
+	}
+
+	if got := fileNameOf("bad%zz"); got != "bad%zz" {
+		t.Errorf("foreign name read as %q", got)
+	}
+}
+
+func TestDiskSearch(t *testing.T) {
+	m := newTestModel(t, "#Go/dev")
+	s := m.servers[1]
+	s.name = "net/1"
+	m.logger = newChatLogger(t.TempDir())
+	defer m.logger.close()
+
+	// a channel line shows in _sys too, it is logged once
+	line := ircChanLineMsg{id: 1, channel: "#Go/dev", line: "<bob> the needle"}
+	m.applyChanLine(line)
+	line.channel, line.mirror = "_sys", true
+	m.applyChanLine(line)
+	if _, err := os.Stat(logFilePath(m.logger.dir, s.name, "_sys")); err == nil {
+		t.Error("mirrored line logged to _sys")
+	}
+
+	// the next session knows the channel by another case
+	s.channels = []string{"#go/dev"}
+	s.channelLogs = map[string][]chatLine{"#go/dev": {{text: "<bob> hello"}}}
+	m.mode = modeSearch
+	m.globalInput.SetValue("needle")
+	msg := m.runGlobalSearch("needle")()
+	m.addDiskResults(msg.(diskResultsMsg))
+
+	items := m.results.Items()
+	if len(items) != 1 {
+		t.Fatalf("%d results", len(items))
+	}
+	r := items[0].(searchResult)
+	if r.id != 1 || r.server != "net/1" || r.channel != "#go/dev" || r.text != "<bob> the needle" {
+		t.Fatalf("result %+v", r)
+	}
+	if filepath.Base(filepath.Dir(r.path)) != "net%2F1" {
+		t.Errorf("logged in %s", r.path)
+	}
+
+	m.jumpToResult(r)
+	if m.mode != modeChat || m.activeID != 1 || m.activeChan != "#go/dev" {
+		t.Errorf("jumped to %d %q in mode %d", m.activeID, m.activeChan, m.mode)
+	}
+}
@@ -0,0 +1,570 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const (
+	passphraseEnv = "CLIRC_PASSPHRASE"
+	secretsFile   = "secrets.json" // next to the config file
+	kdfIterations = 600_000
+	secretCheck   = "clirc" // sealed to tell a wrong passphrase apart
+)
+
+// ${secret:name} in a password, perform line or channel key
+var secretRefRe = regexp.MustCompile(`\$\{secret:([\w.-]+)\}`)
+
+var errLocked = errors.New("secrets are locked")
+
+// secretFile is the on-disk form of the store, every value is
+// sealed with AES-GCM under a key derived from the master passphrase.
+type secretFile struct {
+	Salt    []byte            `json:"salt"`
+	Check   []byte            `json:"check"`
+	Secrets map[string][]byte `json:"secrets"` // name => nonce + ciphertext
+}
+
+// secretStore is shared by all model copies and read from connect goroutines.
+type secretStore struct {
+	mu   sync.Mutex
+	path string
+	file secretFile
+	aead cipher.AEAD       // nil while locked
+	held map[string]string // entered while locked, sealed on unlock or lost on exit
+}
+
+func secretsPath() (string, error) {
+	path, err := configPath()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(filepath.Dir(path), secretsFile), nil
+}
+
+func loadSecrets() (*secretStore, error) {
+	path, err := secretsPath()
+	if err != nil {
+		return &secretStore{}, err
+	}
+
+	st := &secretStore{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return st, nil
+	} else if err != nil {
+		return st, err
+	}
+
+	return st, json.Unmarshal(data, &st.file)
+}
+
+func (st *secretStore) exists() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.file.Salt != nil
+}
+
+func (st *secretStore) unlocked() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.aead != nil
+}
+
+func deriveAEAD(pass string, salt []byte) (cipher.AEAD, error) {
+	k, err := pbkdf2.Key(sha256.New, pass, salt, kdfIterations, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func seal(aead cipher.AEAD, name, value string) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	return aead.Seal(nonce, nonce, []byte(value), []byte(name))
+}
+
+func open(aead cipher.AEAD, name string, data []byte) (string, error) {
+	n := aead.NonceSize()
+	if len(data) < n {
+		return "", errors.New("secret too short")
+	}
+
+	plain, err := aead.Open(nil, data[:n], data[n:], []byte(name))
+	return string(plain), err
+}
+
+// unlock opens the store, or creates it with pass if there is none yet.
+func (st *secretStore) unlock(pass string) error {
+	if pass == "" {
+		return errors.New("empty passphrase")
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.file.Salt == nil {
+		salt := make([]byte, 16)
+		rand.Read(salt)
+		aead, err := deriveAEAD(pass, salt)
+		if err != nil {
+			return err
+		}
+
+		st.file = secretFile{Salt: salt, Check: seal(aead, "", secretCheck), Secrets: map[string][]byte{}}
+		st.aead = aead
+		st.sealHeld()
+		return st.save()
+	}
+
+	aead, err := deriveAEAD(pass, st.file.Salt)
+	if err != nil {
+		return err
+	}
+
+	if v, err := open(aead, "", st.file.Check); err != nil || v != secretCheck {
+		return errors.New("wrong passphrase")
+	}
+
+	st.aead = aead
+	if len(st.held) == 0 {
+		return nil
+	}
+
+	st.sealHeld()
+	return st.save()
+}
+
+// hold keeps a secret entered while the store is locked in memory only,
+// it is written once the store is unlocked.
+func (st *secretStore) hold(name, value string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.held == nil {
+		st.held = map[string]string{}
+	}
+
+	st.held[name] = value
+}
+
+// holds tells whether name only lives in memory, entered while locked.
+func (st *secretStore) holds(name string) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	_, ok := st.held[name]
+	return ok
+}
+
+func (st *secretStore) holding() int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return len(st.held)
+}
+
+// sealHeld moves the held secrets into the file, the caller holds mu.
+func (st *secretStore) sealHeld() {
+	if st.file.Secrets == nil {
+		st.file.Secrets = map[string][]byte{}
+	}
+
+	for name, v := range st.held {
+		st.file.Secrets[name] = seal(st.aead, name, v)
+	}
+	st.held = nil
+}
+
+// save writes the store, the caller holds mu.
+func (st *secretStore) save() error {
+	if st.path == "" {
+		return errors.New("no secrets file")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(st.path), 0o700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(st.file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(st.path, append(data, '\n'), 0o600)
+}
+
+func (st *secretStore) set(name, value string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.aead == nil {
+		return errLocked
+	}
+
+	if st.file.Secrets == nil {
+		st.file.Secrets = map[string][]byte{}
+	}
+
+	st.file.Secrets[name] = seal(st.aead, name, value)
+	return st.save()
+}
+
+func (st *secretStore) del(name string) (bool, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	_, held := st.held[name]
+	delete(st.held, name)
+	if _, ok := st.file.Secrets[name]; !ok {
+		return held, nil
+	}
+
+	delete(st.file.Secrets, name)
+	return true, st.save()
+}
+
+func (st *secretStore) names() []string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	var names []string
+	for n := range st.file.Secrets {
+		if _, ok := st.held[n]; !ok {
+			names = append(names, n)
+		}
+	}
+	for n := range st.held {
+		names = append(names, n+" (unsaved)")
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func (st *secretStore) get(name string) (string, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if v, ok := st.held[name]; ok {
+		return v, nil
+	}
+
+	data, ok := st.file.Secrets[name]
+	switch {
+	case !ok:
+		return "", fmt.Errorf("no secret named %q", name)
+	case st.aead == nil:
+		return "", errLocked
+	}
+
+	return open(st.aead, name, data)
+}
+
+// expand replaces every ${secret:name} in s.
+func (st *secretStore) expand(s string) (string, error) {
+	var err error
+	out := secretRefRe.ReplaceAllStringFunc(s, func(ref string) string {
+		v, e := st.get(secretRefRe.FindStringSubmatch(ref)[1])
+		if e != nil && err == nil {
+			err = e
+		}
+		return v
+	})
+
+	return out, err
+}
+
+func isSecretRef(s string) bool {
+	return secretRefRe.MatchString(s)
+}
+
+// passphraseFromEnv reads the master passphrase from $CLIRC_PASSPHRASE
+// or the first line printed by the passphrase command.
+func passphraseFromEnv(command string) (string, error) {
+	if p := os.Getenv(passphraseEnv); p != "" {
+		return p, nil
+	}
+
+	if command == "" {
+		return "", nil
+	}
+
+	out, err := exec.Command("sh", "-c", command).Output()
+	if err != nil {
+		return "", fmt.Errorf("passphrase command: %w", err)
+	}
+
+	line, _, _ := strings.Cut(string(out), "\n")
+	return strings.TrimRight(line, "\r"), nil
+}
+
+// unlockPrompt asks for the master passphrase.
+// While it is open it receives every key press.
+type unlockPrompt struct {
+	input  textinput.Model
+	create bool // no store yet, the passphrase creates it
+	err    string
+	then   func(m *model) tea.Cmd
+}
+
+// unlockMsg opens the prompt, then runs once it is closed.
+type unlockMsg func(m *model) tea.Cmd
+
+func (m *model) openUnlock(then func(m *model) tea.Cmd) tea.Cmd {
+	ti := textinput.New()
+	ti.Prompt = stylePinkB.Render(" > ")
+	ti.EchoMode = textinput.EchoPassword
+	ti.Width = 40
+	ti.Focus()
+	m.unlock = &unlockPrompt{input: ti, create: !m.secrets.exists(), then: then}
+	return textinput.Blink
+}
+
+func (m model) updateUnlock(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	u := m.unlock
+	switch {
+	case msg.Type == tea.KeyEnter:
+		held := m.secrets.holding()
+		if err := m.secrets.unlock(u.input.Value()); err != nil {
+			u.err = err.Error()
+			u.input.SetValue("")
+			return m, nil
+		}
+
+		m.unlock = nil
+		if held > 0 {
+			// the entries using them can be saved now
+			m.saveServers()
+			m.pushSysLine(m.activeID, "_sys", "-- stored "+plural(held, "secret")+" entered while locked --")
+		}
+		return m, u.then(&m)
+	case key.Matches(msg, m.keys.Back):
+		// go on without secrets, servers using them won't connect
+		m.unlock = nil
+		return m, u.then(&m)
+	}
+
+	var cmd tea.Cmd
+	u.input, cmd = u.input.Update(msg)
+	return m, cmd
+}
+
+func (m model) viewUnlock() string {
+	title, prompt := "Unlock secrets", "Master passphrase for "+m.secrets.path
+	if m.unlock.create {
+		title, prompt = "Create secrets", "Choose a master passphrase for "+m.secrets.path
+	}
+
+	lines := []string{stylePinkB.Render(title), "", stylePink.Render(prompt), m.unlock.input.View()}
+	if m.unlock.err != "" {
+		lines = append(lines, stylePinkB.Render(m.unlock.err))
+	}
+	action := "unlock"
+	if m.unlock.create {
+		action = "create"
+	}
+	lines = append(lines, "", styleDim.Render("enter "+action+" · "+m.keys.Back.Help().Key+" skip"))
+
+	body := lipgloss.JoinVertical(lipgloss.Left, lines...)
+	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, box.Padding(1, 2).Render(body))
+}
+
+// secretCmd implements /secret [set <name> <value>|del <name>|unlock].
+func (m *model) secretCmd(arg string) ([]string, tea.Cmd) {
+	fields := strings.Fields(arg)
+	if len(fields) == 0 {
+		names := m.secrets.names()
+		if len(names) == 0 {
+			return []string{"-- no secrets --"}, nil
+		}
+
+		return []string{"-- secrets: " + strings.Join(names, ", ") + " --"}, nil
+	}
+
+	switch {
+	case fields[0] == "unlock" && len(fields) == 1:
+		if m.secrets.unlocked() {
+			return []string{"-- secrets are unlocked --"}, nil
+		}
+
+		return nil, func() tea.Msg {
+			return unlockMsg(func(m *model) tea.Cmd {
+				if m.secrets.unlocked() {
+					m.sealServers()
+					m.pushSysLine(m.activeID, m.activeChan, "-- secrets unlocked --")
+					m.refreshChat()
+				}
+				return nil
+			})
+		}
+	case fields[0] == "set" && len(fields) >= 3:
+		name := fields[1]
+		value := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(strings.TrimPrefix(arg, "set")), name))
+		if !secretRefRe.MatchString("${secret:" + name + "}") {
+			return []string{"secret names use letters, digits, . _ and -"}, nil
+		}
+
+		store := func(m *model) []string {
+			if err := m.secrets.set(name, value); err != nil {
+				return []string{"secret: " + err.Error()}
+			}
+			return []string{"-- stored " + name + ", use ${secret:" + name + "} --"}
+		}
+
+		if m.secrets.unlocked() {
+			return store(m), nil
+		}
+
+		return nil, func() tea.Msg {
+			return unlockMsg(func(m *model) tea.Cmd {
+				for _, l := range store(m) {
+					m.pushSysLine(m.activeID, m.activeChan, l)
+				}
+				m.refreshChat()
+				return nil
+			})
+		}
+	case fields[0] == "del" && len(fields) == 2:
+		ok, err := m.secrets.del(fields[1])
+		switch {
+		case err != nil:
+			return []string{"secret: " + err.Error()}, nil
+		case !ok:
+			return []string{"no secret named " + fields[1]}, nil
+		}
+
+		return []string{"-- deleted " + fields[1] + " --"}, nil
+	}
+
+	return []string{"usage: /secret [set <name> <value>|del <name>|unlock]"}, nil
+}
+
+// secretName turns a label like "libera-#chan-key" into a store name.
+// The mapping is reversible so different labels never share a secret:
+// '_' is doubled and any other byte outside [A-Za-z0-9.-] becomes _xx.
+func secretName(label string) string {
+	var b strings.Builder
+	for i := 0; i < len(label); i++ {
+		switch c := label[i]; {
+		case c == '.' || c == '-' || ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z'):
+			b.WriteByte(c)
+		case c == '_':
+			b.WriteString("__")
+		default:
+			fmt.Fprintf(&b, "_%02x", c)
+		}
+	}
+
+	return b.String()
+}
+
+// sealSecret moves a plain password entered in the form or with /join
+// into the store, the config then refers to it by the name made from
+// label. It is never saved in the clear: while the store is locked or
+// missing the value is held for this session, the entries using it are
+// not saved until it is stored and the note says so.
+func (m *model) sealSecret(label, value string) (string, string) {
+	if value == "" || isSecretRef(value) {
+		return value, ""
+	}
+
+	name := secretName(label)
+	ref := "${secret:" + name + "}"
+	if !m.secrets.unlocked() {
+		m.secrets.hold(name, value)
+		return ref, "!! " + name + " is kept until clirc exits, the config keeps its old setting: /secret unlock stores it encrypted"
+	}
+
+	if err := m.secrets.set(name, value); err != nil {
+		m.secrets.hold(name, value)
+		return ref, "!! " + name + " is not saved, the config keeps its old setting: " + err.Error()
+	}
+
+	return ref, "-- stored as secret " + name + " --"
+}
+
+// plainSecrets tells if form fields or server entries hold
+// passwords in the clear.
+func plainSecrets(pass, proxy string, keys map[string]string) bool {
+	if pass != "" && !isSecretRef(pass) {
+		return true
+	}
+
+	if u, err := url.Parse(proxy); err == nil && u.User != nil {
+		if p, ok := u.User.Password(); ok && p != "" && !isSecretRef(proxy) {
+			return true
+		}
+	}
+
+	for _, k := range keys {
+		if k != "" && !isSecretRef(k) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *model) hasPlainSecrets() bool {
+	for _, s := range m.servers {
+		if plainSecrets(s.pass, s.proxy, s.chanKeys) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sealServers moves the passwords saved in the clear into the store.
+func (m *model) sealServers() {
+	changed := false
+	for _, s := range m.servers {
+		if s.bouncerNet != "" || !plainSecrets(s.pass, s.proxy, s.chanKeys) {
+			continue
+		}
+
+		var notes []string
+		note := ""
+		if s.pass, note = m.sealSecret(s.name+"-pass", s.pass); note != "" {
+			notes = append(notes, note)
+		}
+		if s.proxy, note = m.sealProxy(s.name+"-proxy", s.proxy); note != "" {
+			notes = append(notes, note)
+		}
+		for ch, key := range s.chanKeys {
+			if note := m.setChanKey(s, ch, key); note != "" {
+				notes = append(notes, note)
+			}
+		}
+
+		for _, n := range notes {
+			m.pushSysLine(s.id, "_sys", n)
+		}
+		changed = true
+	}
+
+	if changed {
+		m.saveServers()
+	}
+}
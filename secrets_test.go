@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestPlainSecrets(t *testing.T) {
+	tests := []struct {
+		name        string
+		pass, proxy string
+		keys        map[string]string
+		want        bool
+	}{
+		{name: "nothing"},
+		{name: "password", pass: "pw", want: true},
+		{name: "password ref", pass: "${secret:x}"},
+		{name: "proxy password", proxy: "socks5h://bob:pw@h:9050", want: true},
+		{name: "proxy ref", proxy: "socks5h://bob:${secret:x}@h:9050"},
+		{name: "proxy user only", proxy: "socks5h://bob@h:9050"},
+		{name: "channel key", keys: map[string]string{"#a": "k"}, want: true},
+		{name: "channel key ref", keys: map[string]string{"#a": "${secret:x}"}},
+	}
+
+	for _, tt := range tests {
+		if got := plainSecrets(tt.pass, tt.proxy, tt.keys); got != tt.want {
+			t.Errorf("%s: got %v", tt.name, got)
+		}
+	}
+}
+
+func TestSealSecretLocked(t *testing.T) {
+	m := newTestModel(t)
+	m.secrets = &secretStore{path: filepath.Join(t.TempDir(), secretsFile)}
+
+	ref, note := m.sealSecret("fake-pass", "hunter2")
+	if ref != "${secret:fake-pass}" || !strings.HasPrefix(note, "!! ") {
+		t.Fatalf("sealed to %q (%s)", ref, note)
+	}
+	if v, err := m.secrets.expand(ref); err != nil || v != "hunter2" {
+		t.Errorf("expands to %q, %v this session", v, err)
+	}
+	if _, err := os.Stat(m.secrets.path); err == nil {
+		t.Error("store written while locked")
+	}
+	if got := m.secrets.names(); len(got) != 1 || got[0] != "fake-pass (unsaved)" {
+		t.Errorf("names %q", got)
+	}
+
+	// creating the store seals what was held
+	if err := m.secrets.unlock("passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(m.secrets.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := &secretStore{path: m.secrets.path}
+	if err := json.Unmarshal(data, &st.file); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.unlock("passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := st.get("fake-pass"); err != nil || v != "hunter2" {
+		t.Errorf("saved %q, %v", v, err)
+	}
+}
+
+func TestFormOffersSecretStore(t *testing.T) {
+	m := newTestModel(t)
+	m.secrets = &secretStore{path: filepath.Join(t.TempDir(), secretsFile)}
+	m.mode = modeForm
+	m.formInputs[fieldName].SetValue("net")
+	m.formInputs[fieldAddr].SetValue("irc.example:6697")
+	m.formInputs[fieldNick].SetValue("me")
+	m.formInputs[fieldPass].SetValue("hunter2")
+	m.formSel = fieldSubmit
+
+	next, _ := m.updateForm(tea.KeyMsg{Type: tea.KeyEnter})
+	m = next.(model)
+	if m.unlock == nil || !m.unlock.create {
+		t.Fatal("no prompt to create the store")
+	}
+
+	// skipping it adds the server without saving the password
+	next, _ = m.updateUnlock(tea.KeyMsg{Type: tea.KeyEsc})
+	m = next.(model)
+	var s *serverEntry
+	for _, e := range m.servers {
+		if e.name == "net" {
+			s = e
+		}
+	}
+	if s == nil || s.pass != "${secret:net-pass}" {
+		t.Fatalf("server %+v", s)
+	}
+
+	data, err := os.ReadFile(os.Getenv(configEnv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "hunter2") {
+		t.Error("config has the password in the clear")
+	}
+	if strings.Contains(string(data), "net-pass") {
+		t.Error("config refers to a secret that is lost on exit")
+	}
+
+	// unlocking later stores the password and saves the entry
+	m.openUnlock(func(*model) tea.Cmd { return nil })
+	m.unlock.input.SetValue("passphrase")
+	next, _ = m.updateUnlock(tea.KeyMsg{Type: tea.KeyEnter})
+	m = next.(model)
+	if data, err = os.ReadFile(os.Getenv(configEnv)); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "${secret:net-pass}") {
+		t.Errorf("entry not saved after unlocking:\n%s", data)
+	}
+	if v, err := m.secrets.get("net-pass"); err != nil || v != "hunter2" || m.secrets.holds("net-pass") {
+		t.Errorf("stored %q, %v", v, err)
+	}
+}
+
+func TestSecretName(t *testing.T) {
+	tests := []struct {
+		label, want string
+	}{
+		{"libera-pass", "libera-pass"},
+		{"net-#a-key", "net-_23a-key"},
+		{"net-_a-key", "net-__a-key"},
+		{"net-_23a-key", "net-__23a-key"},
+		{"net-#é-key", "net-_23_c3_a9-key"},
+	}
+
+	seen := map[string]string{}
+	for _, tt := range tests {
+		got := secretName(tt.label)
+		if got != tt.want {
+			t.Errorf("secretName(%q) = %q, want %q", tt.label, got, tt.want)
+		}
+		if !secretRefRe.MatchString("${secret:" + got + "}") {
+			t.Errorf("%q is not a valid secret name", got)
+		}
+		if other, ok := seen[got]; ok {
+			t.Errorf("%q and %q share %q", tt.label, other, got)
+		}
+		seen[got] = tt.label
+	}
+}
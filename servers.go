@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+var userModesRe = regexp.MustCompile(`^([+-][a-zA-Z]+)+$`)
+
+func validateAddress(addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil || host == "" {
+		return fmt.Errorf("address must be host:port")
+	}
+
+	if port, err := strconv.Atoi(portStr); err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("invalid port %q", portStr)
+	}
+
+	return nil
+}
+
+// splitList splits a comma separated field, dropping empty entries.
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+
+	return out
+}
+
+func (m *model) serverNamed(name string) *serverEntry {
+	for _, s := range m.servers {
+		if strings.EqualFold(s.name, name) {
+			return s
+		}
+	}
+
+	return nil
+}
+
+// listItems returns the server list rows of an entry, one per channel.
+func (s *serverEntry) listItems() []list.Item {
+	if len(s.channels) == 0 {
+		return []list.Item{*s}
+	}
+
+	items := make([]list.Item, 0, len(s.channels))
+	for _, ch := range s.channels {
+		it := *s
+		it.channel = ch
+		items = append(items, it)
+	}
+
+	return items
+}
+
+// restoreServers adds the servers saved in the config,
+// they connect once the program starts.
+func (m *model) restoreServers() {
+	var items []list.Item
+	for _, cfg := range m.cfg.Servers {
+		id := m.nextID
+		m.nextID++
+
+		s := newServerEntry(id, cfg)
+		s.tlsPin = m.cfg.TLSPins[cfg.Address]
+		m.servers[id] = s
+		m.injectASCIIArt(id)
+		items = append(items, s.listItems()...)
+	}
+
+	m.serverList.SetItems(append(items, addServerItem{}))
+}
+
+func (m model) connectAll() tea.Cmd {
+	var cmds []tea.Cmd
+	for id := range m.servers {
+		cmds = append(cmds, connectServerCmd(id))
+	}
+
+	return tea.Batch(cmds...)
+}
+
+// saveServers writes the server entries to the config,
+// networks found through a bouncer are not saved. An entry using a
+// secret entered while the store was locked keeps its saved form.
+func (m *model) saveServers() {
+	var ids []serverID
+	for id, s := range m.servers {
+		if s.bouncerNet == "" {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	prev := map[string]formCfg{}
+	for _, c := range m.cfg.Servers {
+		prev[c.Name] = c
+	}
+
+	servers := make([]formCfg, 0, len(ids))
+	for _, id := range ids {
+		cfg := m.servers[id].config()
+		if m.usesHeldSecret(cfg) {
+			// the secret is lost on exit, don't leave a reference to nothing
+			if old, ok := prev[cfg.Name]; ok {
+				servers = append(servers, old)
+			}
+			continue
+		}
+		servers = append(servers, cfg)
+	}
+
+	m.cfg.Servers = servers
+	if err := saveConfig(*m.cfg); err != nil {
+		log.Println("config:", err)
+	}
+}
+
+// usesHeldSecret tells if cfg refers to a secret that is not stored yet.
+func (m *model) usesHeldSecret(cfg formCfg) bool {
+	fields := append([]string{cfg.Pass, cfg.Proxy}, cfg.Perform...)
+	for _, k := range cfg.ChanKeys {
+		fields = append(fields, k)
+	}
+
+	for _, f := range fields {
+		for _, ref := range secretRefRe.FindAllStringSubmatch(f, -1) {
+			if m.secrets.holds(ref[1]) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFormConfig(t *testing.T) {
+	valid := map[formField]string{fieldName: "libera", fieldAddr: "irc.libera.chat:6697"}
+	with := func(f map[formField]string) map[formField]string {
+		out := map[formField]string{}
+		for k, v := range valid {
+			out[k] = v
+		}
+		for k, v := range f {
+			out[k] = v
+		}
+		return out
+	}
+
+	tests := []struct {
+		name    string
+		fields  map[formField]string
+		wantErr string
+	}{
+		{name: "no name", fields: map[formField]string{fieldAddr: "irc.libera.chat:6697"}, wantErr: "name and address required"},
+		{name: "no address", fields: map[formField]string{fieldName: "libera"}, wantErr: "name and address required"},
+		{name: "taken name", fields: with(map[formField]string{fieldName: "FAKE"}), wantErr: `a server named "FAKE" exists`},
+		{name: "no port", fields: with(map[formField]string{fieldAddr: "irc.libera.chat"}), wantErr: "address must be host:port"},
+		{name: "bad port", fields: with(map[formField]string{fieldAddr: "irc.libera.chat:70000"}), wantErr: `invalid port "70000"`},
+		{name: "bad tls", fields: with(map[formField]string{fieldTLS: "maybe"}), wantErr: "tls: want"},
+		{name: "cert without tls", fields: with(map[formField]string{fieldCert: "me.pem"}), wantErr: "certificates need TLS"},
+		{name: "key without cert", fields: with(map[formField]string{fieldTLS: "yes", fieldKey: "me.key"}), wantErr: "client key without certificate"},
+		{name: "bad proxy", fields: with(map[formField]string{fieldProxy: "ftp://proxy:21"}), wantErr: "proxy: want socks5://"},
+		{name: "bad nick", fields: with(map[formField]string{fieldNick: "1nick"}), wantErr: `invalid nick "1nick"`},
+		{name: "bad alt nick", fields: with(map[formField]string{fieldAltNicks: "me_, #no"}), wantErr: `invalid nick "#no"`},
+		{name: "bad regain", fields: with(map[formField]string{fieldRegain: "steal"}), wantErr: "recover nick"},
+		{name: "bad user", fields: with(map[formField]string{fieldUser: "a b"}), wantErr: `invalid username "a b"`},
+		{name: "bad modes", fields: with(map[formField]string{fieldModes: "ix"}), wantErr: "user modes look like"},
+		{name: "bad channels", fields: with(map[formField]string{fieldChans: "#a,nochan"}), wantErr: "nochan"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestModel(t)
+			for f, v := range tt.fields {
+				m.formInputs[f].SetValue(v)
+			}
+
+			_, err := m.formConfig()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	m := newTestModel(t)
+	m.cfg.Proxy = "socks5://127.0.0.1:9050"
+	for f, v := range with(map[formField]string{
+		fieldTLS:      " TOFU ",
+		fieldNick:     "me",
+		fieldAltNicks: "me_, me__",
+		fieldRegain:   "ghost",
+		fieldModes:    "+ix",
+		fieldChans:    "#a key, #b",
+		fieldCert:     "me.pem",
+	}) {
+		m.formInputs[f].SetValue(v)
+	}
+	got, err := m.formConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := formCfg{
+		Name: "libera", Address: "irc.libera.chat:6697", TLS: true, TLSVerify: verifyTOFU,
+		Nick: "me", AltNicks: []string{"me_", "me__"}, Regain: regainGhost, Modes: "+ix",
+		Chans: []string{"#a", "#b"}, ChanKeys: map[string]string{"#a": "key"},
+		CertFile: "me.pem", Proxy: "socks5://127.0.0.1:9050", // the global proxy by default
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+
+	m.formInputs[fieldNick].SetValue("")
+	if got, _ := m.formConfig(); got.Nick != "zuse" {
+		t.Errorf("default nick %q", got.Nick)
+	}
+}
+
+func TestSaveServersRoundTrip(t *testing.T) {
+	m := newTestModel(t)
+	saved := []formCfg{
+		{Name: "fake", Address: "127.0.0.1:6667", Nick: "me"},
+		{
+			Name: "full", Address: "irc.example:6697", Nick: "me", AltNicks: []string{"me_"}, Regain: regainCmd,
+			User: "u", RealName: "Me", Modes: "+i", TLS: true, TLSVerify: verifyCA, CertFile: "c.pem", KeyFile: "k.pem",
+			CAFile: "ca.pem", Proxy: "socks5h://proxy:1080", Pass: "${secret:full-pass}",
+			Chans: []string{"#a", "#b"}, ChanKeys: map[string]string{"#b": "${secret:full-_23b-key}"},
+			Perform: []string{"/msg NickServ hi"}, Flood: &floodConfig{Burst: 3},
+		},
+	}
+	m.servers[2] = newServerEntry(2, saved[1])
+	child := newServerEntry(3, formCfg{Name: "full/net", Address: "irc.example:6697", Nick: "me"})
+	child.bouncerNet = "net"
+	m.servers[3] = child
+	m.saveServers()
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg.Servers, saved) {
+		t.Fatalf("saved %+v\nwant %+v", cfg.Servers, saved)
+	}
+
+	// and back into entries on the next start
+	keys, err := newKeyMap(cfg.Keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := initialModel(cfg, keys)
+	if len(next.servers) != len(saved) {
+		t.Fatalf("restored %d servers", len(next.servers))
+	}
+	for _, s := range next.servers {
+		i := 0
+		if s.name == "full" {
+			i = 1
+		}
+		if got := s.config(); !reflect.DeepEqual(got, saved[i]) {
+			t.Errorf("restored %+v\nwant %+v", got, saved[i])
+		}
+	}
+	if got := len(next.serverList.Items()); got != 4 { // fake, full · #a, full · #b, add
+		t.Errorf("%d list rows", got)
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lrstanley/girc"
+)
+
+const (
+	dialTimeout = 15 * time.Second
+	tapMaxLine  = 64 << 10 // longer lines reach the taps in pieces
+)
+
+// AUTHENTICATE arguments shown in the console, the rest is credentials
+var saslStepRe = regexp.MustCompile(`^(\+|\*|[A-Z][A-Z0-9-]{0,19})$`)
+
+// connTaps is shared by a server entry and its connections. Every line
+// crossing the connection, above TLS, goes to the taps installed here:
+// the raw console while it is on and the recording of what the server sends.
+type connTaps struct {
+	id      serverID
+	mu      sync.Mutex
+	console *rawTap        // nil while the console is off
+	rec     *os.File       // nil when not recording
+	conn    *tapConn       // the current connection
+	secrets map[string]int // lines queued as sensitive, redacted in the console
+
+	// traffic after the next line we write confirms the lines before it
+	await, armed, heard bool
+}
+
+// linkMsg tells that the server sent something after lines were written.
+type linkMsg struct {
+	id serverID
+	at time.Time
+}
+
+// awaitTraffic asks for a linkMsg once the server sends something after
+// the next line we write.
+func (t *connTaps) awaitTraffic() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.await = true
+}
+
+// takeHeard reports whether a linkMsg is due.
+func (t *connTaps) takeHeard() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	heard := t.heard
+	t.heard = false
+	return heard
+}
+
+// attach puts a tapConn on top of a new connection.
+func (t *connTaps) attach(conn net.Conn) net.Conn {
+	tc := &tapConn{Conn: conn, taps: t}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.conn = tc
+	t.secrets = nil
+	t.await, t.armed, t.heard = false, false, false
+	return tc
+}
+
+// setConsole installs or removes the raw console of server id.
+func (t *connTaps) setConsole(id serverID, on bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case on && t.console == nil:
+		t.console = newRawTap(id)
+	case !on && t.console != nil:
+		t.console.close()
+		t.console = nil
+	}
+}
+
+func (t *connTaps) consoleOn() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.console != nil
+}
+
+// redact hides a sensitive line in the console once it is written.
+func (t *connTaps) redact(e *girc.Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.secrets == nil {
+		t.secrets = map[string]int{}
+	}
+	t.secrets[string(e.Bytes())]++
+}
+
+// tlsState is the TLS session of the connection, when we did the handshake.
+func (t *connTaps) tlsState() (*tls.ConnectionState, bool) {
+	t.mu.Lock()
+	conn := t.conn
+	t.mu.Unlock()
+	if conn == nil {
+		return nil, false
+	}
+
+	tc, ok := conn.Conn.(*tls.Conn)
+	if !ok {
+		return nil, false
+	}
+
+	cs := tc.ConnectionState()
+	return &cs, true
+}
+
+// deliver hands a complete line, terminator included, to the taps.
+func (t *connTaps) deliver(out bool, line []byte, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case out && t.await:
+		t.await, t.armed = false, true
+	case !out && t.armed:
+		t.armed, t.heard = false, true
+	}
+	if !out && t.rec != nil {
+		t.recordLine(line, at)
+	}
+	if t.console == nil {
+		return
+	}
+
+	text := strings.TrimRight(string(line), "\r\n")
+	if out {
+		text = t.redacted(text)
+	}
+	t.console.line(out, girc.StripRaw(text), at)
+}
+
+// redacted hides the credentials of an outgoing line: lines queued as
+// sensitive and what girc sends itself to log in. The caller holds mu.
+func (t *connTaps) redacted(text string) string {
+	e := girc.ParseEvent(text)
+	if e == nil {
+		return text
+	}
+
+	if n := t.secrets[text]; n > 0 {
+		if t.secrets[text] = n - 1; n == 1 {
+			delete(t.secrets, text)
+		}
+		return e.Command + " ***redacted***"
+	}
+
+	switch e.Command {
+	case girc.PASS, girc.OPER, girc.WEBIRC:
+		return e.Command + " ***redacted***"
+	case girc.AUTHENTICATE:
+		if len(e.Params) != 1 || !saslStepRe.MatchString(e.Params[0]) {
+			return e.Command + " ***redacted***"
+		}
+	}
+
+	return text
+}
+
+// tapConn is the connection girc reads and writes, it splits what
+// crosses it into lines for the taps.
+type tapConn struct {
+	net.Conn
+	taps *connTaps
+
+	mu      sync.Mutex
+	in, out []byte // partial lines
+	started bool
+	opaque  bool // girc started TLS on top itself (STS upgrade), nothing to show
+}
+
+func (c *tapConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		at := time.Now()
+		c.split(false, p[:n], at)
+		if c.taps.takeHeard() {
+			program.Send(linkMsg{id: c.taps.id, at: at})
+		}
+	}
+
+	return n, err
+}
+
+func (c *tapConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.split(true, p[:n], time.Now())
+	}
+
+	return n, err
+}
+
+func (c *tapConn) split(out bool, p []byte, at time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.started {
+		// a TLS record where an IRC line should be
+		c.started = true
+		c.opaque = out && p[0] == 0x16
+	}
+	if c.opaque {
+		return
+	}
+
+	buf := &c.in
+	if out {
+		buf = &c.out
+	}
+
+	*buf = append(*buf, p...)
+	for {
+		i := bytes.IndexByte(*buf, '\n')
+		if i < 0 && len(*buf) < tapMaxLine {
+			break
+		} else if i < 0 {
+			i = tapMaxLine - 1
+		}
+
+		c.taps.deliver(out, (*buf)[:i+1], at)
+		*buf = (*buf)[i+1:]
+	}
+
+	if len(*buf) == 0 {
+		*buf = nil
+	}
+}
+
+// connDialer dials a server directly or through its proxy and does the
+// TLS handshake itself, so the taps on top see the lines in the clear.
+type connDialer struct {
+	proxy *proxyDialer // nil to dial directly
+	tls   *tls.Config  // nil for plain text
+	taps  *connTaps
+}
+
+func (d *connDialer) Dial(network, addr string) (net.Conn, error) {
+	var conn net.Conn
+	var err error
+	if d.proxy != nil {
+		conn, err = d.proxy.Dial(network, addr)
+	} else {
+		conn, err = net.DialTimeout(network, addr, dialTimeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if d.tls != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+		defer cancel()
+		tc := tls.Client(conn, d.tls)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tc
+	}
+
+	return d.taps.attach(conn), nil
+}
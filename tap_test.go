@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lrstanley/girc"
+)
+
+// consoleTaps has the console on without a program to send to, the
+// lines stay in the tap's queue.
+func consoleTaps() *connTaps {
+	return &connTaps{console: &rawTap{id: 1, lines: make(chan rawLineMsg, 64)}}
+}
+
+func drain(t *rawTap) []string {
+	var got []string
+	for {
+		select {
+		case msg := <-t.lines:
+			dir := "<"
+			if msg.out {
+				dir = ">"
+			}
+			got = append(got, dir+" "+msg.line)
+		default:
+			return got
+		}
+	}
+}
+
+func TestTapSplit(t *testing.T) {
+	taps := consoleTaps()
+	c := &tapConn{taps: taps}
+	now := time.Now()
+
+	c.split(false, []byte(":srv NOTICE * :hel"), now)
+	c.split(false, []byte("lo\r\n:srv 001 me :welcome\r\nPI"), now)
+	c.split(true, []byte("NICK me\r\nUSER me 0 * :me\r\n"), now)
+	c.split(false, []byte("NG :x\r\n"), now)
+
+	want := []string{
+		"< :srv NOTICE * :hello",
+		"< :srv 001 me :welcome",
+		"> NICK me",
+		"> USER me 0 * :me",
+		"< PING :x",
+	}
+	if got := drain(taps.console); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	long := strings.Repeat("x", tapMaxLine+10)
+	c.split(false, []byte(long), now)
+	if got := drain(taps.console); len(got) != 1 || len(got[0]) != len("< ")+tapMaxLine {
+		t.Errorf("long line delivered as %d pieces", len(got))
+	}
+}
+
+func TestTapRedact(t *testing.T) {
+	taps := consoleTaps()
+	c := &tapConn{taps: taps}
+	taps.redact(girc.ParseEvent("PRIVMSG NickServ :IDENTIFY hunter2"))
+
+	for _, ln := range []string{
+		"PASS hunter2",
+		"OPER me hunter2",
+		"AUTHENTICATE PLAIN",
+		"AUTHENTICATE bWUAbWUAaHVudGVyMg==",
+		"AUTHENTICATE +",
+		"PRIVMSG NickServ :IDENTIFY hunter2",
+		"PRIVMSG NickServ :IDENTIFY hunter2",
+	} {
+		c.split(true, []byte(ln+"\r\n"), time.Now())
+	}
+
+	want := []string{
+		"> PASS ***redacted***",
+		"> OPER ***redacted***",
+		"> AUTHENTICATE PLAIN",
+		"> AUTHENTICATE ***redacted***",
+		"> AUTHENTICATE +",
+		"> PRIVMSG ***redacted***",
+		// only the line queued as sensitive, not the same text typed again
+		"> PRIVMSG NickServ :IDENTIFY hunter2",
+	}
+	if got := drain(taps.console); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestTapConsoleOff(t *testing.T) {
+	taps := &connTaps{}
+	client, server := net.Pipe()
+	defer server.Close()
+	conn := taps.attach(client)
+	defer conn.Close()
+
+	go server.Write([]byte(":srv NOTICE * :hello\r\n"))
+	if _, err := bufio.NewReader(conn).ReadString('\n'); err != nil {
+		t.Fatal(err)
+	}
+	if taps.consoleOn() {
+		t.Error("console on without /console")
+	}
+
+	// switching it on installs the tap, off removes it again
+	taps.mu.Lock()
+	taps.console = &rawTap{id: 1, lines: make(chan rawLineMsg, 4)}
+	tap := taps.console
+	taps.mu.Unlock()
+	taps.setConsole(1, false)
+	if taps.consoleOn() {
+		t.Fatal("console still on")
+	}
+	if _, ok := <-tap.lines; ok {
+		t.Error("tap left open")
+	}
+}
+
+func TestTapOpaque(t *testing.T) {
+	taps := consoleTaps()
+	c := &tapConn{taps: taps}
+
+	// girc's own TLS on top: a handshake record instead of a line
+	c.split(true, []byte{0x16, 0x03, 0x01, 0x00, 0x0a, '\n'}, time.Now())
+	c.split(false, []byte("garbage\n"), time.Now())
+	if got := drain(taps.console); len(got) != 0 {
+		t.Errorf("TLS records shown: %q", got)
+	}
+}
+
+func selfSignedCert(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "irc.test"},
+		DNSNames:     []string{"irc.test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestConnDialerTLS(t *testing.T) {
+	cert := selfSignedCert(t)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		c.Write([]byte(":srv NOTICE * :hello\r\n"))
+		bufio.NewReader(c).ReadString('\n')
+	}()
+
+	taps := consoleTaps()
+	d := &connDialer{tls: &tls.Config{ServerName: "irc.test", InsecureSkipVerify: true}, taps: taps}
+	conn, err := d.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := bufio.NewReader(conn).ReadString('\n'); err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("PASS hunter2\r\n"))
+
+	want := []string{"< :srv NOTICE * :hello", "> PASS ***redacted***"}
+	if got := drain(taps.console); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %q, want %q in the clear", got, want)
+	}
+
+	cs, ok := taps.tlsState()
+	if !ok || len(cs.PeerCertificates) != 1 || !cs.PeerCertificates[0].Equal(mustParse(t, cert)) {
+		t.Errorf("TLS state %v, %v", cs, ok)
+	}
+}
+
+func mustParse(t *testing.T, cert tls.Certificate) *x509.Certificate {
+	t.Helper()
+	c, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func TestTapTraffic(t *testing.T) {
+	taps := &connTaps{}
+	c := &tapConn{taps: taps}
+	now := time.Now()
+
+	taps.awaitTraffic()
+	c.split(false, []byte(":srv NOTICE * :before\r\n"), now)
+	if taps.takeHeard() {
+		t.Fatal("traffic before the next line confirms it")
+	}
+
+	c.split(true, []byte("PRIVMSG #a :hi\r\n"), now)
+	c.split(false, []byte(":srv NOTICE * :after\r\n"), now)
+	if !taps.takeHeard() {
+		t.Fatal("traffic after the line not reported")
+	}
+	if taps.takeHeard() {
+		t.Error("reported twice")
+	}
+}
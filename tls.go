@@ -0,0 +1,246 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/lrstanley/girc"
+)
+
+// how the server certificate is checked
+const (
+	verifyCA       = "ca"       // system roots or the CA bundle
+	verifyTOFU     = "tofu"     // pin the fingerprint seen on first connect
+	verifyInsecure = "insecure" // accept anything
+)
+
+// tlsPinMsg stores the fingerprint a server presented on first use.
+type tlsPinMsg struct {
+	id          serverID
+	fingerprint string
+}
+
+// tlsMismatchMsg reports a pinned server presenting another certificate.
+type tlsMismatchMsg struct {
+	id                serverID
+	pinned, presented string
+}
+
+// parseTLSMode reads the TLS form field: off, on (ca), tofu or insecure.
+func parseTLSMode(s string) (bool, string, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "false", "no", "0", "off":
+		return false, "", nil
+	case "true", "yes", "1", "on", verifyCA:
+		return true, verifyCA, nil
+	case verifyTOFU:
+		return true, verifyTOFU, nil
+	case verifyInsecure:
+		return true, verifyInsecure, nil
+	}
+
+	return false, "", fmt.Errorf("tls: want yes, no, tofu or insecure")
+}
+
+// fingerprint is the hex SHA-256 of a DER certificate.
+func fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// clientCert loads the client certificate, the key may live in the certificate file.
+func (s *serverEntry) clientCert() (tls.Certificate, error) {
+	keyFile := s.keyFile
+	if keyFile == "" {
+		keyFile = s.certFile
+	}
+
+	return tls.LoadX509KeyPair(s.certFile, keyFile)
+}
+
+// tlsConfig builds the client TLS settings of a server entry.
+func (s *serverEntry) tlsConfig(host string) (*tls.Config, error) {
+	conf := &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	if s.certFile != "" {
+		cert, err := s.clientCert()
+		if err != nil {
+			return nil, fmt.Errorf("client certificate: %w", err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	if s.caFile != "" {
+		data, err := os.ReadFile(s.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("CA bundle: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("CA bundle: no certificates in %s", s.caFile)
+		}
+		conf.RootCAs = pool
+	}
+
+	id, pin := s.id, s.tlsPin
+	switch s.tlsVerify {
+	case verifyInsecure:
+		conf.InsecureSkipVerify = true
+	case verifyTOFU:
+		// chain and hostname are not checked, the pin is
+		conf.InsecureSkipVerify = true
+		conf.VerifyConnection = func(cs tls.ConnectionState) error {
+			msg, err := checkPin(id, pin, cs)
+			if msg != nil {
+				program.Send(msg)
+			}
+			return err
+		}
+	}
+
+	return conf, nil
+}
+
+// checkPin compares the server certificate with the pin, msg pins a
+// certificate seen for the first time or reports a changed one.
+func checkPin(id serverID, pin string, cs tls.ConnectionState) (tea.Msg, error) {
+	if len(cs.PeerCertificates) == 0 {
+		return nil, errors.New("server sent no certificate")
+	}
+
+	fp := fingerprint(cs.PeerCertificates[0].Raw)
+	switch pin {
+	case "":
+		return tlsPinMsg{id: id, fingerprint: fp}, nil
+	case fp:
+		return nil, nil
+	}
+
+	return tlsMismatchMsg{id: id, pinned: pin, presented: fp}, errors.New("certificate fingerprint changed")
+}
+
+// applyTLSPin remembers a server fingerprint, keyed by address.
+func (m *model) applyTLSPin(msg tlsPinMsg) {
+	s, ok := m.servers[msg.id]
+	if !ok {
+		return
+	}
+
+	s.tlsPin = msg.fingerprint
+	if m.cfg.TLSPins == nil {
+		m.cfg.TLSPins = map[string]string{}
+	}
+
+	m.cfg.TLSPins[s.address] = msg.fingerprint
+	line := "-- pinned certificate of " + s.address + " (SHA-256 " + msg.fingerprint + ") --"
+	if err := saveConfig(*m.cfg); err != nil {
+		log.Println("config:", err)
+		line += " not saved: " + err.Error()
+	}
+	m.applyChanLine(ircChanLineMsg{id: s.id, channel: "_sys", line: styleDim.Render(line)})
+}
+
+func (m *model) applyTLSMismatch(msg tlsMismatchMsg) {
+	s, ok := m.servers[msg.id]
+	if !ok {
+		return
+	}
+
+	s.tlsPresented = msg.presented
+	for _, l := range []string{
+		"!! certificate of " + s.address + " changed, connection refused",
+		"!! pinned    SHA-256 " + msg.pinned,
+		"!! presented SHA-256 " + msg.presented,
+		"!! if the change is expected, /tlspin trusts the new certificate",
+	} {
+		m.applyChanLine(ircChanLineMsg{id: s.id, channel: "_sys", line: stylePinkB.Render(l)})
+	}
+}
+
+// tlsPin replaces the pin with the certificate last refused and reconnects.
+func (m *model) tlsPin(s *serverEntry) ([]string, tea.Cmd) {
+	if s.tlsPresented == "" {
+		return []string{"no refused certificate to trust"}, nil
+	}
+
+	m.applyTLSPin(tlsPinMsg{id: s.id, fingerprint: s.tlsPresented})
+	s.tlsPresented = ""
+	return []string{"-- reconnecting --"}, connectServerCmd(s.id)
+}
+
+// tlsInfo describes the negotiated TLS session of a server.
+func tlsInfo(s *serverEntry) []string {
+	if !s.tls {
+		return []string{s.address + " is not using TLS"}
+	}
+
+	if s.client == nil || !s.connected {
+		return []string{"not connected"}
+	}
+
+	cs, ok := s.taps.tlsState()
+	if !ok {
+		var err error
+		if cs, err = s.client.TLSConnectionState(); err != nil {
+			return []string{"tlsinfo: " + err.Error()}
+		}
+	}
+
+	verify := s.tlsVerify
+	if verify == verifyCA && s.caFile != "" {
+		verify += " (" + s.caFile + ")"
+	}
+
+	out := []string{
+		"-- TLS " + s.address + " --",
+		"version: " + tls.VersionName(cs.Version),
+		"cipher:  " + tls.CipherSuiteName(cs.CipherSuite),
+		"verify:  " + verify,
+	}
+
+	for i, c := range cs.PeerCertificates {
+		out = append(out,
+			fmt.Sprintf("cert %d: %s", i, c.Subject),
+			fmt.Sprintf("  issuer  %s", c.Issuer),
+			fmt.Sprintf("  valid   %s – %s", c.NotBefore.Format("2006-01-02"), c.NotAfter.Format("2006-01-02")),
+			fmt.Sprintf("  SHA-256 %s", fingerprint(c.Raw)),
+		)
+	}
+
+	if s.tlsPin != "" {
+		out = append(out, "pinned SHA-256 "+s.tlsPin)
+	}
+
+	// the CertFP services like NickServ CERT ADD expect
+	if s.certFile != "" {
+		if cert, err := s.clientCert(); err == nil {
+			out = append(out, "client cert SHA-256 "+fingerprint(cert.Certificate[0]))
+		}
+	}
+
+	return out
+}
+
+// saslConfig uses SASL EXTERNAL when a client certificate is set.
+// Bouncer networks log in with SASL PLAIN when there is a password,
+// BOUNCER BIND has to follow a login before registration ends.
+func saslConfig(s *serverEntry, pass string) girc.SASLMech {
+	if s.bouncerID != "" && pass != "" {
+		user, _ := s.login()
+		return &girc.SASLPlain{User: user, Pass: pass}
+	}
+
+	if s.certFile == "" {
+		return nil
+	}
+
+	return &girc.SASLExternal{}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseTLSMode(t *testing.T) {
+	tests := []struct {
+		field   string
+		on      bool
+		verify  string
+		wantErr bool
+	}{
+		{field: ""},
+		{field: "no"},
+		{field: " Off "},
+		{field: "yes", on: true, verify: verifyCA},
+		{field: "1", on: true, verify: verifyCA},
+		{field: "ca", on: true, verify: verifyCA},
+		{field: "TOFU", on: true, verify: verifyTOFU},
+		{field: "insecure", on: true, verify: verifyInsecure},
+		{field: "maybe", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		on, verify, err := parseTLSMode(tt.field)
+		if (err != nil) != tt.wantErr || on != tt.on || verify != tt.verify {
+			t.Errorf("%q: got %v %q %v", tt.field, on, verify, err)
+		}
+	}
+}
+
+func TestCheckPin(t *testing.T) {
+	cert := mustParse(t, selfSignedCert(t))
+	fp := fingerprint(cert.Raw)
+	cs := tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+
+	// first use pins what is presented
+	msg, err := checkPin(1, "", cs)
+	if pin, ok := msg.(tlsPinMsg); err != nil || !ok || pin.fingerprint != fp || pin.id != 1 {
+		t.Errorf("first use: %#v, %v", msg, err)
+	}
+
+	if msg, err := checkPin(1, fp, cs); msg != nil || err != nil {
+		t.Errorf("pinned: %#v, %v", msg, err)
+	}
+
+	msg, err = checkPin(1, "00ff", cs)
+	if mm, ok := msg.(tlsMismatchMsg); err == nil || !ok || mm.pinned != "00ff" || mm.presented != fp {
+		t.Errorf("changed: %#v, %v", msg, err)
+	}
+
+	if _, err := checkPin(1, fp, tls.ConnectionState{}); err == nil {
+		t.Error("no certificate accepted")
+	}
+}
+
+// tlsServer accepts TLS handshakes with cert until the test ends.
+func tlsServer(t *testing.T, cert tls.Certificate) string {
+	t.Helper()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c.(*tls.Conn).Handshake()
+			c.Close()
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+func TestTLSConfigVerify(t *testing.T) {
+	cert := selfSignedCert(t)
+	addr := tlsServer(t, cert)
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		s       serverEntry
+		wantErr string
+	}{
+		{name: "pin matches", s: serverEntry{tlsVerify: verifyTOFU, tlsPin: fingerprint(cert.Certificate[0])}},
+		{name: "insecure", s: serverEntry{tlsVerify: verifyInsecure}},
+		{name: "self-signed against system roots", s: serverEntry{tlsVerify: verifyCA}, wantErr: "certificate"},
+		{name: "CA bundle", s: serverEntry{tlsVerify: verifyCA, caFile: ca}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, err := tt.s.tlsConfig("irc.test")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c, err := tls.Dial("tcp", addr, conf)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.Close()
+		})
+	}
+
+	bad := serverEntry{tlsVerify: verifyCA, caFile: filepath.Join(t.TempDir(), "none.pem")}
+	if _, err := bad.tlsConfig("irc.test"); err == nil || !strings.Contains(err.Error(), "CA bundle") {
+		t.Errorf("missing CA bundle: %v", err)
+	}
+}
+
+func TestTLSPinMismatch(t *testing.T) {
+	m := newTestModel(t)
+	s := m.servers[1]
+	s.tls, s.tlsVerify = true, verifyTOFU
+
+	m.applyTLSPin(tlsPinMsg{id: 1, fingerprint: "aa"})
+	if s.tlsPin != "aa" || m.cfg.TLSPins[s.address] != "aa" {
+		t.Fatalf("pin %q, saved %q", s.tlsPin, m.cfg.TLSPins)
+	}
+
+	m.applyTLSMismatch(tlsMismatchMsg{id: 1, pinned: "aa", presented: "bb"})
+	if !strings.Contains(sysLines(s), "pinned    SHA-256 aa") || !strings.Contains(sysLines(s), "presented SHA-256 bb") {
+		t.Errorf("mismatch shown as %q", sysLines(s))
+	}
+	if s.tlsPin != "aa" {
+		t.Error("pin replaced before /tlspin")
+	}
+
+	// /tlspin trusts the refused certificate and reconnects
+	out, cmd := m.tlsPin(s)
+	if cmd == nil || len(out) != 1 || out[0] != "-- reconnecting --" {
+		t.Errorf("/tlspin: %q", out)
+	}
+	if s.tlsPin != "bb" || m.cfg.TLSPins[s.address] != "bb" || s.tlsPresented != "" {
+		t.Errorf("pin %q, saved %q, refused %q", s.tlsPin, m.cfg.TLSPins, s.tlsPresented)
+	}
+	if out, cmd := m.tlsPin(s); cmd != nil || out[0] != "no refused certificate to trust" {
+		t.Errorf("second /tlspin: %q", out)
+	}
+}
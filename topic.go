@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/lrstanley/girc"
+)
+
+const (
+	topicScrollInterval = 300 * time.Millisecond
+	topicPause          = 10 // ticks a long topic rests before and after scrolling
+	topicGap            = "   ·   "
+)
+
+// chanInfo is what the header shows about a channel.
+type chanInfo struct {
+	topic string
+	setBy string
+	setAt time.Time
+	modes map[byte]string // channel settings, list and prefix modes aside
+}
+
+// topicReplyMsg is RPL_TOPIC/RPL_NOTOPIC sent on join or on /topic.
+type topicReplyMsg struct {
+	id      serverID
+	channel string
+	topic   string
+}
+
+// topicWhoMsg is RPL_TOPICWHOTIME.
+type topicWhoMsg struct {
+	id      serverID
+	channel string
+	by      string
+	at      time.Time
+}
+
+// chanModesMsg is RPL_CHANNELMODEIS.
+type chanModesMsg struct {
+	id      serverID
+	channel string
+	modes   string
+	args    []string
+}
+
+type topicTickMsg struct{}
+
+// topicScroller moves a topic too long for the header.
+type topicScroller struct {
+	key  string // buffer and text being scrolled
+	pos  int
+	wait int
+}
+
+func topicTick() tea.Cmd {
+	return tea.Tick(topicScrollInterval, func(time.Time) tea.Msg { return topicTickMsg{} })
+}
+
+func addTopicHandlers(c *girc.Client, id serverID) {
+	c.Handlers.Add(girc.RPL_TOPIC, func(_ *girc.Client, e girc.Event) {
+		if len(e.Params) >= 3 {
+			program.Send(topicReplyMsg{id: id, channel: e.Params[1], topic: e.Last()})
+		}
+	})
+	c.Handlers.Add(girc.RPL_NOTOPIC, func(_ *girc.Client, e girc.Event) {
+		if len(e.Params) >= 2 {
+			program.Send(topicReplyMsg{id: id, channel: e.Params[1]})
+		}
+	})
+	c.Handlers.Add(girc.RPL_TOPICWHOTIME, func(_ *girc.Client, e girc.Event) {
+		if len(e.Params) < 4 {
+			return
+		}
+
+		msg := topicWhoMsg{id: id, channel: e.Params[1], by: e.Params[2]}
+		if ts, err := strconv.ParseInt(e.Params[3], 10, 64); err == nil {
+			msg.at = time.Unix(ts, 0)
+		}
+		program.Send(msg)
+	})
+	c.Handlers.Add(girc.RPL_CHANNELMODEIS, func(_ *girc.Client, e girc.Event) {
+		if len(e.Params) >= 3 {
+			program.Send(chanModesMsg{id: id, channel: e.Params[1], modes: e.Params[2], args: e.Params[3:]})
+		}
+	})
+}
+
+func (s *serverEntry) info(ch string) *chanInfo {
+	ch = s.buffer(ch)
+	if s.chanInfo[ch] == nil {
+		s.chanInfo[ch] = &chanInfo{modes: map[byte]string{}}
+	}
+
+	return s.chanInfo[ch]
+}
+
+func (m *model) applyTopicReply(msg topicReplyMsg) {
+	s, ok := m.servers[msg.id]
+	if !ok {
+		return
+	}
+
+	s.info(msg.channel).topic = msg.topic
+	if msg.topic == "" {
+		return
+	}
+
+	line := styleDim.Render("— topic: " + msg.topic)
+	m.applyChanLine(ircChanLineMsg{id: s.id, channel: msg.channel, line: line})
+	m.applyChanLine(ircChanLineMsg{id: s.id, channel: "_sys", line: line, mirror: true})
+}
+
+func (m *model) applyTopicWho(msg topicWhoMsg) {
+	s, ok := m.servers[msg.id]
+	if !ok {
+		return
+	}
+
+	info := s.info(msg.channel)
+	info.setBy, info.setAt = msg.by, msg.at
+	line := styleDim.Render("— set by " + topicSetter(info))
+	m.applyChanLine(ircChanLineMsg{id: s.id, channel: msg.channel, line: line})
+	m.applyChanLine(ircChanLineMsg{id: s.id, channel: "_sys", line: line, mirror: true})
+}
+
+func (m *model) applyChanModes(msg chanModesMsg) {
+	if s, ok := m.servers[msg.id]; ok {
+		info := s.info(msg.channel)
+		info.modes = map[byte]string{}
+		info.applyModes(s.support, s.support.parseModes(msg.modes, msg.args))
+	}
+}
+
+// applyModes keeps the channel settings, ban lists and
+// nick prefixes are not part of them.
+func (info *chanInfo) applyModes(support *isupport, changes []modeChange) {
+	for _, mc := range changes {
+		if !support.isSetting(mc.mode) {
+			continue
+		}
+
+		if mc.add {
+			info.modes[mc.mode] = mc.arg
+		} else {
+			delete(info.modes, mc.mode)
+		}
+	}
+}
+
+// modeString renders the settings as "+klnt", parameters left out.
+func (info *chanInfo) modeString() string {
+	if len(info.modes) == 0 {
+		return ""
+	}
+
+	modes := make([]byte, 0, len(info.modes))
+	for c := range info.modes {
+		modes = append(modes, c)
+	}
+	sort.Slice(modes, func(i, j int) bool { return modes[i] < modes[j] })
+
+	return "+" + string(modes)
+}
+
+func topicSetter(info *chanInfo) string {
+	switch {
+	case info.setBy == "":
+		return "unknown"
+	case info.setAt.IsZero():
+		return info.setBy
+	}
+
+	return info.setBy + " @ " + stamp(info.setAt)
+}
+
+// topicBar returns the fixed left part of the header bar and the topic
+// that follows it, for a channel buffer.
+func (m *model) topicBar() (meta, topic string, ok bool) {
+	s, found := m.servers[m.activeID]
+	if !found || !s.support.isChannel(m.activeChan) {
+		return "", "", false
+	}
+
+	info := s.info(m.activeChan)
+	var parts []string
+	if modes := info.modeString(); modes != "" {
+		parts = append(parts, modes)
+	}
+	parts = append(parts, plural(len(s.members[m.activeChan]), "user"))
+
+	topic = info.topic
+	if topic == "" {
+		topic = "no topic"
+	}
+
+	return strings.Join(parts, " · ") + " · ", topic, true
+}
+
+// viewTopicBar fits the bar into width, a longer topic scrolls.
+func (m model) viewTopicBar(width int) string {
+	meta, topic, ok := m.topicBar()
+	if !ok {
+		return ""
+	}
+
+	avail := width - ansi.StringWidth(meta)
+	if avail <= 0 {
+		return styleDim.Render(ansi.Truncate(meta, width, "…"))
+	}
+
+	if ansi.StringWidth(topic) > avail {
+		loop := topic + topicGap
+		n := m.topicScroll.pos % ansi.StringWidth(loop)
+		topic = ansi.Cut(loop+loop, n, n+avail)
+	}
+
+	return styleDim.Render(meta) + stylePink.Render(topic)
+}
+
+// scrollTopic advances the header topic on every tick,
+// short topics and a fresh buffer stay put.
+func (m *model) scrollTopic() {
+	meta, topic, ok := m.topicBar()
+	key := fmt.Sprint(m.activeID, m.activeChan, topic)
+	if key != m.topicScroll.key {
+		m.topicScroll = topicScroller{key: key, wait: topicPause}
+	}
+
+	if !ok || ansi.StringWidth(meta+topic) <= m.chatW {
+		return
+	}
+
+	if m.topicScroll.wait > 0 {
+		m.topicScroll.wait--
+		return
+	}
+
+	m.topicScroll.pos++
+	if m.topicScroll.pos >= ansi.StringWidth(topic+topicGap) {
+		m.topicScroll.pos = 0
+		m.topicScroll.wait = topicPause
+	}
+}
+
+// topicCmd implements /topic [text], without text it shows the full topic.
+func (m *model) topicCmd(s *serverEntry, ch, arg string) []string {
+	if !s.support.isChannel(ch) {
+		return []string{"/topic works in a channel buffer"}
+	}
+
+	if arg = strings.TrimSpace(arg); arg != "" {
+		if s.client == nil || !s.connected {
+			return []string{"not connected"}
+		}
+
+		if n := s.support.maxTopic(); n > 0 && len(arg) > n {
+			return []string{fmt.Sprintf("topic too long, %d of at most %d bytes", len(arg), n)}
+		}
+
+		m.sendLine(s, &girc.Event{Command: girc.TOPIC, Params: []string{ch, arg}})
+		return nil
+	}
+
+	info := s.info(ch)
+	if info.topic == "" {
+		return []string{"-- no topic on " + ch + " --"}
+	}
+
+	out := []string{"-- topic of " + ch + " --", info.topic, "set by " + topicSetter(info)}
+	if modes := info.modeString(); modes != "" {
+		out = append(out, "modes "+modes)
+	}
+
+	return out
+}
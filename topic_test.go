@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+func topicTestModel(t *testing.T, topic string) model {
+	t.Helper()
+	m := newTestModel(t, "#a")
+	m.activeID, m.activeChan = 1, "#a"
+	s := m.servers[1]
+	s.members = map[string]map[string]bool{"#a": {"me": true, "bob": true}}
+	info := s.info("#a")
+	info.topic = topic
+	info.modes = map[byte]string{'t': "", 'n': "", 'k': "key"}
+	return m
+}
+
+func TestTopicBar(t *testing.T) {
+	m := topicTestModel(t, "")
+	meta, topic, ok := m.topicBar()
+	if !ok || meta != "+knt · 2 users · " || topic != "no topic" {
+		t.Errorf("got %q %q %v", meta, topic, ok)
+	}
+
+	m.activeChan = "_sys"
+	if _, _, ok := m.topicBar(); ok {
+		t.Error("bar for a non-channel buffer")
+	}
+}
+
+func TestViewTopicBar(t *testing.T) {
+	const meta = "+knt · 2 users · "
+	w := ansi.StringWidth(meta)
+	tests := []struct {
+		name  string
+		topic string
+		width int
+		pos   int
+		want  string
+	}{
+		{name: "fits", topic: "hello", width: 40, want: meta + "hello"},
+		{name: "exactly fits", topic: "0123456789", width: w + 10, want: meta + "0123456789"},
+		{name: "cut", topic: "0123456789", width: w + 4, want: meta + "0123"},
+		{name: "scrolled", topic: "0123456789", width: w + 4, pos: 8, want: meta + "89  "},
+		{name: "round the loop", topic: "0123456789", width: w + 4, pos: 17, want: meta + "0123"},
+		{name: "wide runes", topic: "日本語のトピック", width: w + 5, want: meta + "日本"},
+		{name: "no room for the topic", topic: "hello", width: 10, want: "+knt · 2 …"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := topicTestModel(t, tt.topic)
+			m.topicScroll.pos = tt.pos
+			got := ansi.Strip(m.viewTopicBar(tt.width))
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if w := ansi.StringWidth(got); w > tt.width {
+				t.Errorf("%d cells wide, room for %d", w, tt.width)
+			}
+		})
+	}
+}
+
+func TestScrollTopic(t *testing.T) {
+	long := strings.Repeat("x", 200)
+	m := topicTestModel(t, long)
+
+	// rests first, then one cell per tick
+	for i := 0; i < topicPause; i++ {
+		m.scrollTopic()
+	}
+	if m.topicScroll.pos != 0 || m.topicScroll.wait != 0 {
+		t.Fatalf("pos %d, wait %d after the pause", m.topicScroll.pos, m.topicScroll.wait)
+	}
+	m.scrollTopic()
+	m.scrollTopic()
+	if m.topicScroll.pos != 2 {
+		t.Errorf("pos %d, want 2", m.topicScroll.pos)
+	}
+
+	// round the loop it starts over and rests again
+	m.topicScroll.pos = ansi.StringWidth(long+topicGap) - 1
+	m.scrollTopic()
+	if m.topicScroll.pos != 0 || m.topicScroll.wait != topicPause {
+		t.Errorf("pos %d, wait %d after a loop", m.topicScroll.pos, m.topicScroll.wait)
+	}
+
+	// a new topic starts from the beginning
+	m.topicScroll.pos, m.topicScroll.wait = 5, 0
+	m.servers[1].info("#a").topic = long + "y"
+	m.scrollTopic()
+	if m.topicScroll.pos != 0 || m.topicScroll.wait != topicPause-1 {
+		t.Errorf("pos %d, wait %d on a new topic", m.topicScroll.pos, m.topicScroll.wait)
+	}
+
+	// a topic that fits doesn't move
+	short := topicTestModel(t, "short")
+	for i := 0; i < topicPause+5; i++ {
+		short.scrollTopic()
+	}
+	if short.topicScroll.pos != 0 {
+		t.Errorf("short topic scrolled to %d", short.topicScroll.pos)
+	}
+}